@@ -0,0 +1,336 @@
+package rcom
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+)
+
+// batchPath is appended to the URL of a server
+// to post a Batch instead of a single Command
+const batchPath = "/batch"
+
+// errNilOnItem is returned for batches executed without onItem function
+var errNilOnItem = errors.New("rcom.Batch: nil onItem function")
+
+// BatchOrder is the order in which
+// the items of a batch are returned.
+type BatchOrder int
+
+const (
+	// BatchCompletionOrder returns every item
+	// as soon as its command completed
+	BatchCompletionOrder BatchOrder = iota
+	// BatchInputOrder returns the items
+	// in the order of Batch.Commands
+	BatchInputOrder
+)
+
+// Batch holds many commands that are sent to a server
+// with one request and executed there in parallel.
+type Batch struct {
+	Commands []*Command
+	// MaxParallel limits how many commands of the batch
+	// the server executes in parallel.
+	// DefaultBatchParallelism is used if it is not positive.
+	// The Policy.MaxConcurrent limit of the server
+	// applies to the commands of batches too.
+	MaxParallel int
+	// Order of the returned items
+	Order BatchOrder
+}
+
+// commandNames returns the sorted unique names
+// of the commands of the batch.
+func (b *Batch) commandNames() []string {
+	names := make([]string, 0, len(b.Commands))
+	for _, c := range b.Commands {
+		if c != nil {
+			names = append(names, c.Name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// BatchItem is the outcome of a command of a Batch
+type BatchItem struct {
+	// Index of the command in Batch.Commands
+	Index int
+	// Result of the command if Err is nil
+	Result *Result
+	// Err is the error of the command.
+	// It wraps an *exec.ExitError if the command
+	// exited with an error exit code
+	// and is a *PipelineError if a command of a pipeline failed.
+	Err error
+}
+
+// batchItem is the encoding of a BatchItem
+// in the response stream of a batch
+type batchItem struct {
+	Index         int
+	Result        *Result
+	Error         string
+	ExitError     *exec.ExitError
+	PipelineError *PipelineError
+}
+
+func (i *batchItem) item() BatchItem {
+	item := BatchItem{Index: i.Index, Result: i.Result}
+	switch {
+	case i.PipelineError != nil:
+		item.Err = i.PipelineError
+	case i.Error != "":
+		item.Err = &batchError{msg: i.Error, exitErr: i.ExitError}
+	}
+	return item
+}
+
+// batchError is the error of a command of a batch
+// that was executed by a server.
+type batchError struct {
+	msg     string
+	exitErr *exec.ExitError
+}
+
+func (e *batchError) Error() string { return e.msg }
+
+func (e *batchError) Unwrap() error {
+	if e.exitErr == nil {
+		return nil
+	}
+	return e.exitErr
+}
+
+// ExecuteBatchRemotely executes the commands of the batch
+// at the server with the passed address, see ExecuteRemotely,
+// and calls onItem for every item as soon as it is received
+// in the order configured by Batch.Order.
+// A failing command does not stop the batch,
+// its error is passed as BatchItem.Err.
+// If onItem returns an error then the remaining commands
+// are canceled and the error is returned.
+// Batches are executed without idempotency key,
+// so executing a failed batch again can execute
+// some of its commands a second time.
+func ExecuteBatchRemotely(ctx context.Context, addr string, batch *Batch, onItem func(BatchItem) error) error {
+	return executeBatchRemotely(ctx, nil, addr, batch, onItem)
+}
+
+func executeBatchRemotely(ctx context.Context, client *http.Client, addr string, batch *Batch, onItem func(BatchItem) error) error {
+	log.Debug("ExecuteBatchRemotely").
+		Str("addr", addr).
+		Int("commands", len(batch.Commands)).
+		Str("correlationID", correlationIDFromContext(ctx)).
+		Log()
+
+	if onItem == nil {
+		return errNilOnItem
+	}
+	for i, c := range batch.Commands {
+		if c == nil {
+			return fmt.Errorf("rcom.Batch: nil command %d", i)
+		}
+		err := c.Validate()
+		if err != nil {
+			return fmt.Errorf("rcom.Batch: command %d: %w", i, err)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(batch)
+	if err != nil {
+		return err
+	}
+
+	// Canceling the request when onItem fails
+	// stops the remaining commands at the server
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	response, err := post(ctx, client, addr, batchPath, buf, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	dec := gob.NewDecoder(response.Body)
+	for received := 0; received < len(batch.Commands); received++ {
+		var item batchItem
+		err = dec.Decode(&item)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("rcom.Batch: received %d of %d items: %w", received, len(batch.Commands), err)
+		}
+		err = onItem(item.item())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveBatch executes the commands of a batch request
+// with bounded parallelism and streams the items
+// of the response as soon as they can be written.
+func (s *service) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var batch Batch
+	err := gob.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		log.Error("can't decode batch request").
+			Err(err).
+			Log()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parallel := batch.MaxParallel
+	if parallel <= 0 {
+		parallel = DefaultBatchParallelism
+	}
+	parallel = max(min(parallel, len(batch.Commands)), 1)
+
+	correlationID := r.Header.Get(correlationIDHeader)
+	log.Infof("Executing batch of %d commands", len(batch.Commands)).
+		Int("parallel", parallel).
+		Str("correlationID", correlationID).
+		Log()
+
+	// Canceled when the response can't be written
+	// to stop the remaining commands
+	ctx, cancel := context.WithCancel(contextWithCorrelationID(r.Context(), correlationID))
+	defer cancel()
+
+	// A slot is taken for every started command and released
+	// when its item was written, so that with BatchInputOrder
+	// at most parallel items wait for their predecessors
+	slots := make(chan struct{}, parallel)
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := range batch.Commands {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	items := make(chan *batchItem)
+	var workers sync.WaitGroup
+	for range parallel {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indices {
+				item := s.executeBatchItem(ctx, i, batch.Commands[i], correlationID)
+				select {
+				case items <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(items)
+	}()
+
+	enc := gob.NewEncoder(w)
+	flusher := http.NewResponseController(w)
+	pending := make(map[int]*batchItem)
+	next := 0
+	for item := range items {
+		ready := []*batchItem{item}
+		if batch.Order == BatchInputOrder {
+			pending[item.Index] = item
+			ready = ready[:0]
+			for pending[next] != nil {
+				ready = append(ready, pending[next])
+				delete(pending, next)
+				next++
+			}
+		}
+		for _, item := range ready {
+			err = enc.Encode(item)
+			if err != nil {
+				log.Error("can't encode batch response").
+					Err(err).
+					Int("index", item.Index).
+					Log()
+				cancel()
+				// Wait until the workers stopped
+				for range items {
+				}
+				return
+			}
+			<-slots
+		}
+		// Not every ResponseWriter supports flushing
+		_ = flusher.Flush()
+	}
+}
+
+// executeBatchItem executes a command of a batch
+// like a single command request would.
+func (s *service) executeBatchItem(ctx context.Context, index int, command *Command, correlationID string) *batchItem {
+	item := &batchItem{Index: index}
+	result, err := s.executeBatchCommand(ctx, index, command, correlationID)
+	if err != nil {
+		item.Error = err.Error()
+		errors.As(err, &item.ExitError)
+		errors.As(err, &item.PipelineError)
+		return item
+	}
+	item.Result = result
+	return item
+}
+
+func (s *service) executeBatchCommand(ctx context.Context, index int, command *Command, correlationID string) (*Result, error) {
+	if command == nil {
+		return nil, errors.New("rcom.Batch: nil command")
+	}
+	err := s.checkPolicy(command)
+	if err != nil {
+		return nil, err
+	}
+
+	phaseStart := time.Now()
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	queue := time.Since(phaseStart)
+
+	log.Infof("Executing batch command: %s", command).
+		Int("index", index).
+		Str("correlationID", correlationID).
+		Log()
+	result, err := s.execute(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	// The result could be shared by a middleware
+	response := *result
+	response.Report.Phases.Queue = queue
+	return &response, nil
+}
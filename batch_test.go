@@ -0,0 +1,148 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Client_ExecuteBatch(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy("sh")})
+	defer server.Close()
+	client := NewClient(ClientAllowAllCmds(), ClientWithBaseURL(server.URL))
+
+	sh := func(script string) *Command { return &Command{Name: "sh", Args: []string{"-c", script}} }
+	batch := &Batch{
+		Commands: []*Command{
+			sh("sleep 0.5; echo 0"),
+			sh("exit 3"),
+			sh("echo 2"),
+			{Name: "rm"},
+		},
+		MaxParallel: 4,
+	}
+
+	for _, order := range []BatchOrder{BatchCompletionOrder, BatchInputOrder} {
+		batch.Order = order
+		var items []BatchItem
+		err := client.ExecuteBatch(context.Background(), batch, func(item BatchItem) error {
+			items = append(items, item)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, items, 4)
+
+		indices := make([]int, len(items))
+		byIndex := make(map[int]BatchItem)
+		for i, item := range items {
+			indices[i] = item.Index
+			byIndex[item.Index] = item
+		}
+		if order == BatchInputOrder {
+			assert.Equal(t, []int{0, 1, 2, 3}, indices)
+		} else {
+			assert.Equal(t, 0, indices[3], "slowest command completes last")
+		}
+
+		require.NoError(t, byIndex[0].Err)
+		assert.Equal(t, "0\n", byIndex[0].Result.Stdout)
+		require.NoError(t, byIndex[2].Err)
+		assert.Equal(t, "2\n", byIndex[2].Result.Stdout)
+
+		var exitErr *exec.ExitError
+		require.True(t, errors.As(byIndex[1].Err, &exitErr), "exit error of failing command")
+		assert.Equal(t, 3, exitErr.ExitCode)
+		assert.Nil(t, byIndex[1].Result)
+		assert.ErrorContains(t, byIndex[3].Err, "not allowed")
+	}
+
+	// Errors of the callback cancel the batch
+	stop := errors.New("stop")
+	err := client.ExecuteBatch(context.Background(), batch, func(BatchItem) error { return stop })
+	assert.ErrorIs(t, err, stop)
+}
+
+func Test_Client_ExecuteBatch_nilOnItem(t *testing.T) {
+	client := NewClient(ClientAllowAllCmds(), ClientWithBaseURL("http://127.0.0.1:1"))
+	err := client.ExecuteBatch(context.Background(), &Batch{Commands: []*Command{{Name: "sh"}}}, nil)
+	assert.ErrorIs(t, err, errNilOnItem)
+	err = ExecuteBatchRemotely(context.Background(), "http://127.0.0.1:1", &Batch{Commands: []*Command{{Name: "sh"}}}, nil)
+	assert.ErrorIs(t, err, errNilOnItem)
+}
+
+func Test_serveBatch_InputOrderWindow(t *testing.T) {
+	// The first command blocks until the others had
+	// the chance to run, only the window of parallel
+	// commands may start before its item was written
+	var started, startedBeforeFirst atomic.Int32
+	handler, err := NewHandler(NewPolicy("sh"), func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			if command.Args[0] == "0" {
+				time.Sleep(100 * time.Millisecond)
+				startedBeforeFirst.Store(started.Load())
+			} else {
+				started.Add(1)
+			}
+			return new(Result), nil
+		})
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	batch := &Batch{MaxParallel: 2, Order: BatchInputOrder}
+	for i := range 10 {
+		batch.Commands = append(batch.Commands, &Command{Name: "sh", Args: []string{strconv.Itoa(i)}})
+	}
+	err = ExecuteBatchRemotely(context.Background(), server.URL, batch, func(BatchItem) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), startedBeforeFirst.Load())
+	assert.Equal(t, int32(9), started.Load())
+}
+
+func Test_serveBatch_path(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy("sh")})
+	defer server.Close()
+
+	batch := &Batch{Commands: []*Command{{Name: "sh", Args: []string{"-c", "echo"}}}}
+	err := ExecuteBatchRemotely(context.Background(), server.URL, batch, func(BatchItem) error { return nil })
+	require.NoError(t, err)
+
+	// Paths that only end with the batch path are single command requests
+	err = ExecuteBatchRemotely(context.Background(), server.URL+"/other", batch, func(BatchItem) error { return nil })
+	assert.Error(t, err)
+}
+
+func Test_Client_ExecuteBatch_CircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{Window: 2, MinExecutions: 2, OpenDuration: time.Minute})
+	client := NewClient(ClientAllowAllCmds(), ClientWithBaseURL(broken.URL), ClientWithCircuitBreaker(breaker))
+	batch := &Batch{Commands: []*Command{{Name: "sh"}, {Name: "echo"}, {Name: "sh"}}}
+	onItem := func(BatchItem) error { return nil }
+	for range 2 {
+		err := client.ExecuteBatch(context.Background(), batch, onItem)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	err := client.ExecuteBatch(context.Background(), batch, onItem)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, CircuitOpen, breaker.State(broken.URL, "sh"))
+	assert.Equal(t, CircuitOpen, breaker.State(broken.URL, "echo"))
+}
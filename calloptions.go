@@ -0,0 +1,99 @@
+package rcom
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/ungerik/go-fs"
+)
+
+// CallOption configures a single execution
+// of Client.ExecuteWithOptions.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	stdin             []byte
+	stdinFile         fs.FileReader
+	nonErrorExitCodes []int
+	timeout           time.Duration
+	correlationID     string
+}
+
+// WithStdin passes data as stdin to the command.
+func WithStdin(data []byte) CallOption {
+	return func(o *callOptions) { o.stdin = data }
+}
+
+// WithStdinFile passes the content of file as stdin to the command.
+func WithStdinFile(file fs.FileReader) CallOption {
+	return func(o *callOptions) { o.stdinFile = file }
+}
+
+// WithNonErrorExitCodes sets non zero exit codes
+// that are returned as Result.ExitCode
+// instead of being considered an error.
+func WithNonErrorExitCodes(codes ...int) CallOption {
+	return func(o *callOptions) { o.nonErrorExitCodes = append(o.nonErrorExitCodes, codes...) }
+}
+
+// WithCallTimeout limits the duration of the execution
+// instead of the timeout set with ClientWithTimeOut.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = timeout }
+}
+
+// WithCorrelationID sends an ID with the request
+// that the server logs with the execution
+// to correlate it with the logs of the caller.
+func WithCorrelationID(id string) CallOption {
+	return func(o *callOptions) { o.correlationID = id }
+}
+
+// apply returns a copy of command with the options applied
+// that does not modify the passed command.
+func (o *callOptions) apply(ctx context.Context, command *Command) (*Command, error) {
+	c := *command
+	var err error
+	switch {
+	case o.stdinFile != nil:
+		c.Stdin, err = o.stdinFile.ReadAllContext(ctx)
+	case o.stdin != nil:
+		c.Stdin = o.stdin
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(o.nonErrorExitCodes) > 0 {
+		c.NonErrorExitCodes = maps.Clone(c.NonErrorExitCodes)
+		if c.NonErrorExitCodes == nil {
+			c.NonErrorExitCodes = make(map[int]bool, len(o.nonErrorExitCodes))
+		}
+		for _, code := range o.nonErrorExitCodes {
+			c.NonErrorExitCodes[code] = true
+		}
+	}
+	return &c, nil
+}
+
+// correlationIDHeader is the HTTP header used by the client
+// to send the ID passed with WithCorrelationID
+const correlationIDHeader = "Rcom-Correlation-ID"
+
+type correlationIDKey struct{}
+
+// contextWithCorrelationID returns a context
+// holding the correlation ID if it is not empty.
+func contextWithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// correlationIDFromContext returns the correlation ID
+// of the context or an empty string.
+func correlationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
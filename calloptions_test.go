@@ -0,0 +1,72 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ungerik/go-fs"
+)
+
+func Test_Client_ExecuteWithOptions(t *testing.T) {
+	var correlationID string
+	svc := &service{policy: NewPolicy("cat", "sh", "sleep")}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID = r.Header.Get(correlationIDHeader)
+		svc.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	client := NewClient(ClientWithCmds("cat", "sh", "sleep"), ClientWithBaseURL(server.URL))
+	ctx := context.Background()
+
+	cat := &Command{Name: "cat"}
+	result, err := client.ExecuteWithOptions(ctx, cat, WithStdin([]byte("stdin")), WithCorrelationID("correlation"))
+	require.NoError(t, err)
+	assert.Equal(t, "stdin", result.Stdout)
+	assert.Equal(t, "correlation", correlationID)
+	assert.Nil(t, cat.Stdin, "command not modified")
+
+	result, err = client.ExecuteWithOptions(ctx, cat, WithStdinFile(fs.NewMemFile("stdin.txt", []byte("file"))))
+	require.NoError(t, err)
+	assert.Equal(t, "file", result.Stdout)
+
+	exit3 := &Command{Name: "sh", Args: []string{"-c", "exit 3"}}
+	_, err = client.ExecuteWithOptions(ctx, exit3)
+	assert.Error(t, err)
+	result, err = client.ExecuteWithOptions(ctx, exit3, WithNonErrorExitCodes(3))
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Nil(t, exit3.NonErrorExitCodes, "command not modified")
+
+	start := time.Now()
+	_, err = client.ExecuteWithOptions(ctx, &Command{Name: "sleep", Args: []string{"10"}}, WithCallTimeout(100*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func Test_Client_ExecuteArgs(t *testing.T) {
+	client := NewClient(ClientWithCmds("cat", "sh"))
+	_, err := client.ExecuteArgs(context.Background(), nil, nil)
+	assert.Error(t, err, "several commands")
+}
+
+func Test_Client_Execute_notAllowed(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer server.Close()
+	command, _ := cpCommand()
+
+	_, err := NewClient(ClientWithBaseURL(server.URL)).Execute(context.Background(), command)
+	assert.ErrorContains(t, err, "not allowed", "commands are denied by default")
+
+	_, err = NewClient(ClientWithCmds("cat"), ClientWithBaseURL(server.URL)).Execute(context.Background(), command)
+	assert.ErrorContains(t, err, "not allowed")
+
+	_, err = NewClient(ClientAllowAllCmds(), ClientWithBaseURL(server.URL)).Execute(context.Background(), command)
+	assert.NoError(t, err)
+}
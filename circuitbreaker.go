@@ -0,0 +1,398 @@
+package rcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+)
+
+// ErrCircuitOpen is returned by executions that were rejected
+// without being sent because the circuit breaker of the
+// endpoint and command is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of a circuit breaker circuit
+type CircuitState string
+
+const (
+	// CircuitClosed lets all executions through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects all executions with ErrCircuitOpen
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a limited number of probe executions
+	// through to test if the endpoint recovered
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreakerPolicy configures when a CircuitBreaker opens
+// and how it recovers.
+type CircuitBreakerPolicy struct {
+	// Window is the number of most recent executions
+	// of a circuit that the failure rate is calculated from
+	Window int
+	// MinExecutions is the number of executions within
+	// the window that are needed before the circuit can open
+	MinExecutions int
+	// FailureRate between 0 and 1 of the executions
+	// within the window at which the circuit opens
+	FailureRate float64
+	// OpenDuration is how long an open circuit rejects
+	// executions before it becomes half-open
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of probe executions
+	// that a half-open circuit lets through.
+	// The circuit closes if all of them succeed
+	// and opens again if one fails.
+	HalfOpenProbes int
+	// IsFailure returns if the error of an execution
+	// counts as failure of the circuit.
+	// IsCircuitFailure is used if nil.
+	IsFailure func(error) bool
+	// OnStateChange is called when a circuit changes its state
+	OnStateChange func(key CircuitKey, from, to CircuitState)
+}
+
+// DefaultCircuitBreakerPolicy opens a circuit when half
+// of at least 10 of the last 20 executions failed
+// and probes it again after 30 seconds.
+var DefaultCircuitBreakerPolicy = CircuitBreakerPolicy{
+	Window:         20,
+	MinExecutions:  10,
+	FailureRate:    0.5,
+	OpenDuration:   30 * time.Second,
+	HalfOpenProbes: 1,
+}
+
+// IsCircuitFailure returns if the error of an execution
+// indicates that the endpoint is unavailable or broken:
+// ErrNotStarted, connections that were reset or closed
+// before the response was complete, and responses
+// with a 5xx status that are no command exit errors.
+// Rejected requests, commands that exited with an error exit code
+// and executions canceled by the caller or its deadline are no failures,
+// so one caller can't open a circuit shared with others.
+func IsCircuitFailure(err error) bool {
+	if err == nil || isCallerError(err) {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+	if errors.Is(err, ErrNotStarted) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.code >= http.StatusInternalServerError
+}
+
+// isCallerError returns if the execution was stopped
+// by the caller with its context which tells
+// nothing about the endpoint.
+func isCallerError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// CircuitKey identifies the circuit of a CircuitBreaker
+type CircuitKey struct {
+	// Endpoint is the URL of a Client endpoint
+	// or the name passed to CircuitBreaker.Executer
+	Endpoint string
+	// Command is the name of the executed command
+	Command string
+}
+
+func (k CircuitKey) String() string {
+	return k.Endpoint + " " + k.Command
+}
+
+// CircuitStatus is the state of a circuit with its statistics
+// within the window of the policy for metrics and logs.
+type CircuitStatus struct {
+	Key        CircuitKey
+	State      CircuitState
+	Executions int
+	Failures   int
+	// OpenedAt is the time the circuit opened the last time
+	OpenedAt time.Time
+}
+
+// CircuitBreaker tracks the failure rates of executions
+// per endpoint and command and rejects executions
+// with ErrCircuitOpen while their circuit is open,
+// so callers don't have to wait for failing endpoints.
+// A CircuitBreaker can be shared by multiple clients.
+type CircuitBreaker struct {
+	policy CircuitBreakerPolicy
+
+	mtx      sync.Mutex
+	circuits map[CircuitKey]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	outcomes []bool // ring buffer of failures
+	next     int
+	openedAt time.Time
+	probes   int
+	probed   int
+}
+
+// NewCircuitBreaker returns a CircuitBreaker with the policy.
+// Zero values of the policy are set from DefaultCircuitBreakerPolicy.
+func NewCircuitBreaker(policy CircuitBreakerPolicy) *CircuitBreaker {
+	if policy.Window <= 0 {
+		policy.Window = DefaultCircuitBreakerPolicy.Window
+	}
+	if policy.MinExecutions <= 0 {
+		policy.MinExecutions = min(DefaultCircuitBreakerPolicy.MinExecutions, policy.Window)
+	}
+	if policy.FailureRate <= 0 {
+		policy.FailureRate = DefaultCircuitBreakerPolicy.FailureRate
+	}
+	if policy.OpenDuration <= 0 {
+		policy.OpenDuration = DefaultCircuitBreakerPolicy.OpenDuration
+	}
+	if policy.HalfOpenProbes <= 0 {
+		policy.HalfOpenProbes = DefaultCircuitBreakerPolicy.HalfOpenProbes
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = IsCircuitFailure
+	}
+	return &CircuitBreaker{
+		policy:   policy,
+		circuits: make(map[CircuitKey]*circuit),
+	}
+}
+
+// allow returns ErrCircuitOpen if the circuit of the key
+// rejects an execution, else the returned function
+// has to be called with the error of the execution.
+func (b *CircuitBreaker) allow(key CircuitKey) (done func(error), err error) {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	c := b.circuits[key]
+	if c == nil {
+		c = &circuit{state: CircuitClosed, outcomes: make([]bool, 0, b.policy.Window)}
+		b.circuits[key] = c
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.policy.OpenDuration {
+		notify = b.setState(key, c, CircuitHalfOpen)
+	}
+	switch c.state {
+	case CircuitOpen:
+		return nil, fmt.Errorf("%w for %s", ErrCircuitOpen, key)
+	case CircuitHalfOpen:
+		if c.probes >= b.policy.HalfOpenProbes {
+			return nil, fmt.Errorf("%w for %s while probing", ErrCircuitOpen, key)
+		}
+		c.probes++
+		return func(err error) { b.probeDone(key, c, err) }, nil
+	default:
+		return func(err error) {
+			if !isCallerError(err) {
+				b.record(key, c, b.policy.IsFailure(err))
+			}
+		}, nil
+	}
+}
+
+// allowAll calls allow for the circuits of all commands
+// and returns ErrCircuitOpen if one of them rejects the execution.
+// The returned function has to be called with the error
+// of the execution that is recorded for all circuits.
+func (b *CircuitBreaker) allowAll(endpoint string, commands []string) (done func(error), err error) {
+	dones := make([]func(error), 0, len(commands))
+	done = func(err error) {
+		for _, d := range dones {
+			d(err)
+		}
+	}
+	for _, command := range commands {
+		d, err := b.allow(CircuitKey{Endpoint: endpoint, Command: command})
+		if err != nil {
+			// Release the allowed circuits without recording
+			done(context.Canceled)
+			return nil, err
+		}
+		dones = append(dones, d)
+	}
+	return done, nil
+}
+
+func (b *CircuitBreaker) record(key CircuitKey, c *circuit, failed bool) {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if c.state != CircuitClosed {
+		// The circuit opened while the execution was running
+		return
+	}
+	if len(c.outcomes) < b.policy.Window {
+		c.outcomes = append(c.outcomes, failed)
+	} else {
+		c.outcomes[c.next] = failed
+		c.next = (c.next + 1) % b.policy.Window
+	}
+	failures := c.failures()
+	if len(c.outcomes) >= b.policy.MinExecutions && float64(failures) >= b.policy.FailureRate*float64(len(c.outcomes)) {
+		notify = b.setState(key, c, CircuitOpen)
+	}
+}
+
+func (b *CircuitBreaker) probeDone(key CircuitKey, c *circuit, err error) {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	switch {
+	case c.state != CircuitHalfOpen:
+	case b.policy.IsFailure(err):
+		notify = b.setState(key, c, CircuitOpen)
+	case isCallerError(err):
+		// Let another execution probe the endpoint
+		c.probes--
+	default:
+		c.probed++
+		if c.probed >= b.policy.HalfOpenProbes {
+			notify = b.setState(key, c, CircuitClosed)
+		}
+	}
+}
+
+// setState changes the state of the circuit
+// and resets its statistics for the new state.
+// The returned function logs the change and calls OnStateChange
+// and has to be called after the mutex was unlocked.
+func (b *CircuitBreaker) setState(key CircuitKey, c *circuit, state CircuitState) (notify func()) {
+	from := c.state
+	c.state = state
+	c.probes = 0
+	c.probed = 0
+	switch state {
+	case CircuitOpen:
+		c.openedAt = time.Now()
+	case CircuitClosed:
+		c.outcomes = c.outcomes[:0]
+		c.next = 0
+	}
+
+	return func() {
+		log.Warn("Circuit breaker state changed").
+			Str("endpoint", key.Endpoint).
+			Str("command", key.Command).
+			Str("from", string(from)).
+			Str("to", string(state)).
+			Log()
+		if b.policy.OnStateChange != nil {
+			b.policy.OnStateChange(key, from, state)
+		}
+	}
+}
+
+func (c *circuit) failures() (n int) {
+	for _, failed := range c.outcomes {
+		if failed {
+			n++
+		}
+	}
+	return n
+}
+
+// State returns the state of the circuit
+// of the endpoint and command.
+func (b *CircuitBreaker) State(endpoint, command string) CircuitState {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	c := b.circuits[CircuitKey{Endpoint: endpoint, Command: command}]
+	if c == nil {
+		return CircuitClosed
+	}
+	return b.currentState(c)
+}
+
+// currentState returns the state of the circuit
+// which is half-open for an open circuit after the
+// open duration even before the next execution.
+func (b *CircuitBreaker) currentState(c *circuit) CircuitState {
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.policy.OpenDuration {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// Status returns the status of all circuits
+// sorted by endpoint and command.
+func (b *CircuitBreaker) Status() []CircuitStatus {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	status := make([]CircuitStatus, 0, len(b.circuits))
+	for key, c := range b.circuits {
+		status = append(status, CircuitStatus{
+			Key:        key,
+			State:      b.currentState(c),
+			Executions: len(c.outcomes),
+			Failures:   c.failures(),
+			OpenedAt:   c.openedAt,
+		})
+	}
+	slices.SortFunc(status, func(a, b CircuitStatus) int {
+		return strings.Compare(a.Key.String(), b.Key.String())
+	})
+	return status
+}
+
+// Executer returns an Executer that executes commands
+// with the passed executer while the circuit of the
+// endpoint name and the command name is not open.
+func (b *CircuitBreaker) Executer(endpoint string, executer Executer) Executer {
+	return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+		done, err := b.allow(CircuitKey{Endpoint: endpoint, Command: command.Name})
+		if err != nil {
+			return nil, err
+		}
+		result, err := executer.Execute(ctx, command)
+		done(err)
+		return result, err
+	})
+}
+
+// Middleware returns a Middleware that wraps executers
+// like CircuitBreaker.Executer with the endpoint name.
+func (b *CircuitBreaker) Middleware(endpoint string) Middleware {
+	return func(next Executer) Executer {
+		return b.Executer(endpoint, next)
+	}
+}
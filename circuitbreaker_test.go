@@ -0,0 +1,130 @@
+package rcom
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	var changes []CircuitState
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{
+		Window:         4,
+		MinExecutions:  2,
+		FailureRate:    0.5,
+		OpenDuration:   50 * time.Millisecond,
+		HalfOpenProbes: 1,
+		OnStateChange:  func(key CircuitKey, from, to CircuitState) { changes = append(changes, to) },
+	})
+
+	var fail atomic.Bool
+	var calls atomic.Int32
+	executer := breaker.Executer("host", ExecuterFunc(func(context.Context, *Command) (*Result, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return nil, fmt.Errorf("%w: connection refused", ErrNotStarted)
+		}
+		return new(Result), nil
+	}))
+	ctx := context.Background()
+	command := &Command{Name: "cmd"}
+
+	_, err := executer.Execute(ctx, command)
+	require.NoError(t, err)
+	fail.Store(true)
+	_, err = executer.Execute(ctx, command)
+	require.Error(t, err)
+	assert.Equal(t, CircuitOpen, breaker.State("host", "cmd"), "one of two failed")
+
+	_, err = executer.Execute(ctx, command)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), calls.Load(), "rejected without calling the executer")
+	assert.Equal(t, CircuitClosed, breaker.State("host", "other"), "circuits are per command")
+
+	// Failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, breaker.State("host", "cmd"))
+	_, err = executer.Execute(ctx, command)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, CircuitOpen, breaker.State("host", "cmd"))
+
+	// Successful probe closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	fail.Store(false)
+	_, err = executer.Execute(ctx, command)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitClosed, breaker.State("host", "cmd"))
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+
+	// Exit errors of commands are no failures of the endpoint
+	executer = breaker.Executer("host", ExecuterFunc(func(context.Context, *Command) (*Result, error) {
+		return nil, &exec.ExitError{ExitCode: 1}
+	}))
+	for range 4 {
+		_, err = executer.Execute(ctx, command)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	status := breaker.Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, CircuitStatus{Key: CircuitKey{"host", "cmd"}, State: CircuitClosed, Executions: 4, OpenedAt: status[0].OpenedAt}, status[0])
+}
+
+func Test_Client_CircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{Window: 2, MinExecutions: 2, OpenDuration: time.Minute})
+	client := NewClient(ClientAllowAllCmds(), ClientWithBaseURL(broken.URL), ClientWithCircuitBreaker(breaker))
+	command, _ := cpCommand()
+	for range 2 {
+		_, err := client.Execute(context.Background(), command)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	_, err := client.Execute(context.Background(), command)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, CircuitOpen, breaker.State(broken.URL, copyCmd()))
+}
+
+func Test_Client_CircuitBreaker_callerErrors(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(correlationIDHeader) == "slow" {
+			<-release
+			return
+		}
+		http.Error(w, `command "cp" not allowed`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	breaker := NewCircuitBreaker(CircuitBreakerPolicy{Window: 2, MinExecutions: 2, OpenDuration: time.Minute})
+	client := NewClient(ClientAllowAllCmds(), ClientWithBaseURL(server.URL), ClientWithCircuitBreaker(breaker))
+	command, _ := cpCommand()
+	for range 4 {
+		_, err := client.Execute(context.Background(), command)
+		assert.ErrorContains(t, err, "400")
+	}
+	assert.Equal(t, CircuitClosed, breaker.State(server.URL, copyCmd()), "rejected requests are no failures")
+
+	for range 4 {
+		_, err := client.ExecuteWithOptions(context.Background(), command,
+			WithCallTimeout(10*time.Millisecond),
+			WithCorrelationID("slow"),
+		)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	assert.Equal(t, CircuitClosed, breaker.State(server.URL, copyCmd()), "exceeded deadlines of callers are no failures")
+}
@@ -2,26 +2,43 @@ package rcom
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/domonda/go-types/uu"
 	"github.com/ungerik/go-fs"
 )
 
 // Client is a base for building rcom base clients.
+// It implements the Executer interface.
 type Client struct {
-	cmds    map[string]bool
+	cmds         map[string]bool
+	allowAllCmds bool
 	host    string
 	port    uint16
 	timeout time.Duration
+
+	addrs         []string
+	balancing     Balancing
+	ejectFailures int
+	ejectDuration time.Duration
+	retry         RetryPolicy
+	httpClient    *http.Client
+	breaker       *CircuitBreaker
+
+	endpointsOnce sync.Once
+	endpoints     *endpoints
 }
 
-// Execute executes the services' cmd remotely with given arguments and returns a result.
-func (c *Client) ExecuteWithCommand(ctx context.Context, cmd string, cmdArgs []string, files []fs.FileReader, resultFilePatterns ...string) (*Result, error) {
-	if !c.cmds[cmd] {
-		return nil, fmt.Errorf("command %q not allowd", cmd)
-	}
+var _ Executer = new(Client)
 
+// ExecuteWithCommand executes the services' cmd remotely with given arguments and returns a result.
+func (c *Client) ExecuteWithCommand(ctx context.Context, cmd string, cmdArgs []string, files []fs.FileReader, resultFilePatterns ...string) (*Result, error) {
 	command := &Command{
 		Name:               cmd,
 		Args:               cmdArgs,
@@ -40,26 +57,252 @@ func (c *Client) ExecuteWithCommand(ctx context.Context, cmd string, cmdArgs []s
 		}
 	}
 
-	if c.timeout > 0 {
-		timeoutCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	return c.Execute(ctx, command)
+}
+
+// Execute implements the Executer interface
+// by executing the command remotely.
+// Only the commands set with ClientWithCmds are allowed,
+// including all pipeline stages,
+// or all commands with ClientAllowAllCmds.
+func (c *Client) Execute(ctx context.Context, command *Command) (*Result, error) {
+	return c.execute(ctx, command, nil, nil)
+}
+
+// ExecuteWithOptions executes the command remotely like Execute
+// with the options applied to this call only.
+// The passed command is not modified.
+func (c *Client) ExecuteWithOptions(ctx context.Context, command *Command, opts ...CallOption) (*Result, error) {
+	return c.execute(ctx, command, nil, opts)
+}
+
+// ExecuteToDir executes the command remotely like ExecuteWithOptions
+// but streams the result files selected by filesOpts into dir
+// instead of returning them in Result.Files.
+// The files are written part by part while they are received
+// without buffering them in memory,
+// so dir can be a local directory or any go-fs file system.
+// Only the client streams the files, the server still reads
+// all result files into memory before sending them,
+// so their total size is limited by the memory of the server.
+// If the call fails then the files it created are removed,
+// existing files that were already overwritten are kept
+// and returned with the error.
+// The written files are returned in the order of their result file names.
+func (c *Client) ExecuteToDir(ctx context.Context, command *Command, dir fs.File, filesOpts WriteFilesOptions, opts ...CallOption) (*Result, []fs.File, error) {
+	dest := &filesDestination{dir: dir, opts: filesOpts}
+	result, err := c.execute(ctx, command, dest, opts)
+	if err != nil {
+		if removeErr := dest.removeCreated(); removeErr != nil {
+			log.Error("Can't remove result files of failed call").
+				Err(removeErr).
+				Log()
+		}
+		return nil, dest.written, err
+	}
+	return result, dest.written, nil
+}
+
+func (c *Client) execute(ctx context.Context, command *Command, dest *filesDestination, opts []CallOption) (*Result, error) {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	command, err := o.apply(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range command.names() {
+		if !c.allows(name) {
+			return nil, fmt.Errorf("command %q not allowed", name)
+		}
+	}
+
+	timeout := c.timeout
+	if o.timeout > 0 {
+		timeout = o.timeout
+	}
+	if timeout > 0 {
+		timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		ctx = timeoutCtx
 	}
+	ctx = contextWithCorrelationID(ctx, o.correlationID)
 
-	return ExecuteRemotely(ctx, fmt.Sprintf("http://%s:%d", c.host, c.port), command)
+	return c.executeRemotely(ctx, command, dest)
 }
 
-// Execute executes the service remotely with given arguments and returns a result.
-// Method will panic if it is called when client allows execution of more then one
-// commands, in that the ExecuteWithCommand should be used.
-func (c *Client) Execute(ctx context.Context, cmdArgs []string, files []fs.FileReader, resultFilePatterns ...string) (*Result, error) {
-	if len(c.cmds) != 1 {
-		panic(fmt.Errorf("client allows execution of multiple commands"))
+// executeRemotely executes the command at one of the endpoints
+// and fails over to the next endpoint if the command
+// was not started because of an ErrNotStarted error
+// or the circuit of the endpoint is open.
+// Retryable errors are retried with the retry policy of the client.
+func (c *Client) executeRemotely(ctx context.Context, command *Command, dest *filesDestination) (*Result, error) {
+	// All attempts use the same key so that
+	// a server never executes the command twice
+	key := uu.IDv7().String()
+	return c.retry.retry(ctx, func() (*Result, error) {
+		return c.executeAtEndpoints(ctx, command, key, dest)
+	})
+}
+
+func (c *Client) executeAtEndpoints(ctx context.Context, command *Command, idempotencyKey string, dest *filesDestination) (result *Result, err error) {
+	endpoints := c.getEndpoints()
+	tried := make(map[*endpoint]bool)
+	for {
+		ep := endpoints.pick(tried)
+		if ep == nil {
+			// All endpoints failed, return the last error
+			return nil, err
+		}
+		tried[ep] = true
+
+		breakerDone := func(error) {}
+		if c.breaker != nil {
+			breakerDone, err = c.breaker.allow(CircuitKey{Endpoint: ep.url, Command: command.Name})
+			if err != nil {
+				// Try the next endpoint without
+				// waiting for this failing one
+				endpoints.release(ep)
+				continue
+			}
+		}
+
+		result, err = executeRemotely(ctx, ep.client, ep.url, command, idempotencyKey, dest)
+		breakerDone(err)
+		notStarted := errors.Is(err, ErrNotStarted)
+		endpoints.done(ep, isUnreachable(err))
+		if !notStarted || ctx.Err() != nil {
+			return result, err
+		}
+		log.Warn("Failing over to next endpoint").
+			Str("endpoint", ep.url).
+			Err(err).
+			Log()
+	}
+}
+
+// ExecuteBatch executes the commands of the batch
+// at one of the endpoints, see ExecuteBatchRemotely.
+// The batch fails over to the next endpoint if it was not started
+// or the circuit of one of its commands is open,
+// but is not retried because it is not deduplicated by the server.
+// With a circuit breaker the batch counts as one execution
+// for the circuit of every command name of the batch
+// that fails only with an error of the whole batch,
+// errors of single commands are passed to onItem.
+// The timeout set with ClientWithTimeOut does not apply
+// to the whole batch, use the context to limit its duration.
+func (c *Client) ExecuteBatch(ctx context.Context, batch *Batch, onItem func(BatchItem) error) (err error) {
+	if onItem == nil {
+		return errNilOnItem
+	}
+	for i, command := range batch.Commands {
+		if command == nil {
+			continue
+		}
+		for _, name := range command.names() {
+			if !c.allows(name) {
+				return fmt.Errorf("command %d %q not allowed", i, name)
+			}
+		}
+	}
+
+	endpoints := c.getEndpoints()
+	tried := make(map[*endpoint]bool)
+	for {
+		ep := endpoints.pick(tried)
+		if ep == nil {
+			// All endpoints failed, return the last error
+			return err
+		}
+		tried[ep] = true
+
+		breakerDone := func(error) {}
+		if c.breaker != nil {
+			breakerDone, err = c.breaker.allowAll(ep.url, batch.commandNames())
+			if err != nil {
+				endpoints.release(ep)
+				continue
+			}
+		}
+
+		var itemErr error
+		err = executeBatchRemotely(ctx, ep.client, ep.url, batch, func(item BatchItem) error {
+			itemErr = onItem(item)
+			return itemErr
+		})
+		if err != nil && err == itemErr {
+			// Stopped by the caller, not by the endpoint
+			breakerDone(context.Canceled)
+		} else {
+			breakerDone(err)
+		}
+		notStarted := errors.Is(err, ErrNotStarted)
+		endpoints.done(ep, isUnreachable(err))
+		if !notStarted || ctx.Err() != nil {
+			return err
+		}
+		log.Warn("Failing over to next endpoint").
+			Str("endpoint", ep.url).
+			Err(err).
+			Log()
 	}
-	for cmd := range c.cmds {
-		return c.ExecuteWithCommand(ctx, cmd, cmdArgs, files, resultFilePatterns...)
+}
+
+// allows returns if the client allows executing the command name.
+func (c *Client) allows(name string) bool {
+	return c.allowAllCmds || c.cmds[name]
+}
+
+func (c *Client) getEndpoints() *endpoints {
+	c.endpointsOnce.Do(func() {
+		addrs := c.addrs
+		if len(addrs) == 0 {
+			addrs = []string{fmt.Sprintf("%s:%d", c.host, c.port)}
+		}
+		c.endpoints = &endpoints{
+			balancing:     c.balancing,
+			ejectFailures: c.ejectFailures,
+			ejectDuration: c.ejectDuration,
+		}
+		if c.endpoints.ejectFailures <= 0 {
+			c.endpoints.ejectFailures = DefaultEjectAfterFailures
+		}
+		if c.endpoints.ejectDuration <= 0 {
+			c.endpoints.ejectDuration = DefaultEjectDuration
+		}
+		for _, addr := range addrs {
+			ep := &endpoint{url: endpointURL(addr), client: c.httpClient}
+			if _, ok := unixSocketPath(addr); ok && c.httpClient != nil {
+				// Keep the derived client to reuse its connections,
+				// an error is returned again by every request
+				if _, client, err := httpClientFor(c.httpClient, addr); err == nil {
+					ep.client = client
+				}
+			}
+			c.endpoints.list = append(c.endpoints.list, ep)
+		}
+	})
+	return c.endpoints
+}
+
+// EjectedEndpoints returns the URLs of the endpoints
+// that are currently ejected because of failures.
+func (c *Client) EjectedEndpoints() []string {
+	return c.getEndpoints().ejected()
+}
+
+// ExecuteArgs executes the service remotely with given arguments and returns a result.
+// It returns an error if the client does not allow exactly one command,
+// in that case ExecuteWithCommand should be used.
+func (c *Client) ExecuteArgs(ctx context.Context, cmdArgs []string, files []fs.FileReader, resultFilePatterns ...string) (*Result, error) {
+	if len(c.cmds) != 1 {
+		return nil, fmt.Errorf("client allows execution of %d commands, use ExecuteWithCommand", len(c.cmds))
 	}
-	panic("unreachable statement")
+	cmd := slices.Collect(maps.Keys(c.cmds))[0]
+	return c.ExecuteWithCommand(ctx, cmd, cmdArgs, files, resultFilePatterns...)
 }
 
 // ClientOption represents Client option.
@@ -77,6 +320,13 @@ func ClientWithCmds(cmds ...string) ClientOption {
 	}
 }
 
+// ClientAllowAllCmds allows the client to execute all commands
+// instead of only those set with ClientWithCmds.
+// The Policy of the server still decides which commands are executed.
+func ClientAllowAllCmds() ClientOption {
+	return func(c *Client) { c.allowAllCmds = true }
+}
+
 // WithHost sets Client.host attribute.
 func ClientWithHost(host string) ClientOption {
 	return func(c *Client) { c.host = host }
@@ -92,6 +342,78 @@ func ClientWithTimeOut(timeout time.Duration) ClientOption {
 	return func(c *Client) { c.timeout = timeout }
 }
 
+// ClientWithEndpoints sets multiple endpoints
+// as "host:port", URL like "https://host:port/prefix",
+// or Unix domain socket address like "unix:///var/run/rcom.sock"
+// that requests are balanced over instead of
+// the single endpoint set by ClientWithHost and ClientWithPort.
+func ClientWithEndpoints(addrs ...string) ClientOption {
+	return func(c *Client) { c.addrs = append(c.addrs, addrs...) }
+}
+
+// ClientWithBaseURL sets the URL of the server
+// including scheme, host and an optional path prefix
+// like "https://example.com/rcom" or a Unix domain socket
+// address like "unix:///var/run/rcom.sock"
+// instead of the host and port.
+func ClientWithBaseURL(url string) ClientOption {
+	return ClientWithEndpoints(url)
+}
+
+// ClientWithHTTPClient sets the HTTP client used for requests.
+// The default is http.DefaultClient.
+func ClientWithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) { c.httpClient = client }
+}
+
+// ClientWithTransport sets the RoundTripper used for requests
+// by the default or the client set with ClientWithHTTPClient.
+// Unix domain socket addresses need an *http.Transport.
+func ClientWithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		client := new(http.Client)
+		if c.httpClient != nil {
+			*client = *c.httpClient
+		}
+		client.Transport = transport
+		c.httpClient = client
+	}
+}
+
+// ClientWithBalancing sets the strategy to pick an endpoint.
+// The default is BalanceRoundRobin.
+func ClientWithBalancing(balancing Balancing) ClientOption {
+	return func(c *Client) { c.balancing = balancing }
+}
+
+// ClientWithEjection sets after how many consecutive failures
+// an endpoint is ejected and for how long.
+// The defaults are DefaultEjectAfterFailures and DefaultEjectDuration.
+// Failures are requests that could not reach the endpoint,
+// requests rejected with status 429 or 503 because of overload
+// fail over to the next endpoint without counting as failure.
+func ClientWithEjection(failures int, duration time.Duration) ClientOption {
+	return func(c *Client) {
+		c.ejectFailures = failures
+		c.ejectDuration = duration
+	}
+}
+
+// ClientWithRetry sets the policy for retrying
+// requests that failed with a retryable error.
+// Requests are not retried by default.
+func ClientWithRetry(retry RetryPolicy) ClientOption {
+	return func(c *Client) { c.retry = retry }
+}
+
+// ClientWithCircuitBreaker rejects executions with ErrCircuitOpen
+// for endpoints and commands with an open circuit of the breaker
+// and fails over to other endpoints if possible.
+// The breaker can be shared by multiple clients.
+func ClientWithCircuitBreaker(breaker *CircuitBreaker) ClientOption {
+	return func(c *Client) { c.breaker = breaker }
+}
+
 // NewClient returns new client with attributes set by given opts.
 func NewClient(opts ...ClientOption) *Client {
 	c := new(Client)
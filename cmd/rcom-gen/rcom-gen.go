@@ -0,0 +1,269 @@
+/*
+Command rcom-gen generates typed Go functions
+for commands described by rcom.CommandSpec JSON files.
+
+Usage with go generate:
+
+	//go:generate go run github.com/domonda/go-rcom/cmd/rcom-gen pdftoppm.json
+
+For every spec file "name.json" the file "name_rcom.go"
+is written to the same directory in the package
+of the go generate call or the package set with -package.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/domonda/go-rcom"
+)
+
+func main() {
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated files, defaults to $GOPACKAGE")
+	out := flag.String("out", "", "output file if there is only one spec file, defaults to the spec file name with _rcom.go suffix")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rcom-gen [flags] spec.json...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *pkg == "" || (*out != "" && flag.NArg() > 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, specFile := range flag.Args() {
+		outFile := *out
+		if outFile == "" {
+			outFile = strings.TrimSuffix(specFile, filepath.Ext(specFile)) + "_rcom.go"
+		}
+		err := generateFile(specFile, outFile, *pkg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "rcom-gen:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func generateFile(specFile, outFile, pkg string) error {
+	data, err := os.ReadFile(specFile)
+	if err != nil {
+		return err
+	}
+	spec, err := rcom.ParseCommandSpec(data)
+	if err != nil {
+		return fmt.Errorf("invalid command spec file %s: %w", specFile, err)
+	}
+	source, err := generate(spec, data, filepath.Base(specFile), pkg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, source, 0644)
+}
+
+// generate returns the formatted Go source for the spec
+// which is embedded as specJSON in the generated code.
+func generate(spec *rcom.CommandSpec, specJSON []byte, specFile, pkg string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]any{
+		"Package":  pkg,
+		"SpecFile": specFile,
+		"SpecJSON": stringLiteral(string(bytes.TrimSpace(specJSON))),
+		"Func":     spec.FuncName(),
+		"Spec":     spec,
+		"Strconv":  usesStrconv(spec),
+		"Fmt":      hasRequiredOutput(spec),
+	})
+	if err != nil {
+		return nil, err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("can't format generated code for %s: %w\n%s", specFile, err, buf.Bytes())
+	}
+	return source, nil
+}
+
+// stringLiteral returns s as raw string literal if possible
+func stringLiteral(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+func usesStrconv(spec *rcom.CommandSpec) bool {
+	for _, arg := range spec.Args {
+		if arg.Name != "" && (arg.Type == rcom.ArgInt || arg.Type == rcom.ArgFloat) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRequiredOutput(spec *rcom.CommandSpec) bool {
+	for _, file := range spec.OutputFiles {
+		if file.Required {
+			return true
+		}
+	}
+	return false
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"comment": func(doc string) string {
+		if doc == "" {
+			return ""
+		}
+		return "// " + strings.ReplaceAll(strings.TrimSpace(doc), "\n", "\n// ") + "\n"
+	},
+	"goType": func(t rcom.ArgType) string {
+		switch t {
+		case rcom.ArgInt:
+			return "int"
+		case rcom.ArgFloat:
+			return "float64"
+		case rcom.ArgBool:
+			return "bool"
+		default:
+			return "string"
+		}
+	},
+	"formatValue": func(arg rcom.ArgSpec) string {
+		switch arg.Type {
+		case rcom.ArgInt:
+			return "strconv.Itoa(p." + arg.Name + ")"
+		case rcom.ArgFloat:
+			return "strconv.FormatFloat(p." + arg.Name + ", 'f', -1, 64)"
+		default:
+			return "p." + arg.Name
+		}
+	},
+	"zeroValue": func(t rcom.ArgType) string {
+		if t == rcom.ArgString {
+			return `""`
+		}
+		return "0"
+	},
+}).Parse(`// Code generated by rcom-gen from {{.SpecFile}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- if .Fmt}}
+	"fmt"
+{{- end}}
+{{- if .Strconv}}
+	"strconv"
+{{- end}}
+
+	"github.com/domonda/go-rcom"
+)
+
+{{$f := .Func -}}
+// {{$f}}Spec is the spec of the {{.Spec.Command}} command
+// that a server can use to validate arguments
+// with rcom.CommandPolicy.Spec.
+var {{$f}}Spec = rcom.MustParseCommandSpec([]byte({{.SpecJSON}}))
+
+// {{$f}}Params are the arguments and input files of {{$f}}.
+type {{$f}}Params struct {
+{{- range .Spec.Args}}{{if .Name}}
+	{{comment .Doc}}{{.Name}} {{goType .Type}}
+{{- end}}{{end}}
+{{- range .Spec.InputFiles}}
+	{{comment .Doc}}{{.Name}} []byte
+{{- end}}
+}
+
+// {{$f}}Result is the result of {{$f}} with its output files.
+type {{$f}}Result struct {
+	*rcom.Result
+{{range .Spec.OutputFiles}}
+	{{comment .Doc}}{{.Name}} {{if .Multiple}}map[string][]byte{{else}}[]byte{{end}}
+{{- end}}
+}
+
+// Command returns the rcom.Command for the params
+// or an error if they don't match {{$f}}Spec.
+func (p *{{$f}}Params) Command() (*rcom.Command, error) {
+	var args []string
+{{- range .Spec.Args}}
+{{- if not .Name}}
+	args = append(args, {{if .Flag}}{{quote .Flag}}, {{end}}{{quote .Value}})
+{{- else if eq .Type "bool"}}
+	if p.{{.Name}} {
+		args = append(args, {{quote .Flag}})
+	}
+{{- else if not .Flag}}
+	args = append(args, {{formatValue .}})
+{{- else if .Required}}
+	args = append(args, {{quote .Flag}}, {{formatValue .}})
+{{- else}}
+	if p.{{.Name}} != {{zeroValue .Type}} {
+		args = append(args, {{quote .Flag}}, {{formatValue .}})
+	}
+{{- end}}
+{{- end}}
+
+	command := &rcom.Command{
+		Name: {{quote .Spec.Command}},
+		Args: args,
+{{- if .Spec.OutputFiles}}
+		ResultFilePatterns: []string{ {{- range .Spec.OutputFiles}}{{quote .File}}, {{end -}} },
+{{- end}}
+	}
+{{- if .Spec.InputFiles}}
+	command.Files = make(map[string][]byte)
+{{- range .Spec.InputFiles}}
+	if p.{{.Name}} != nil {
+		command.Files[{{quote .File}}] = p.{{.Name}}
+	}
+{{- end}}
+{{- end}}
+
+	err := {{$f}}Spec.ValidateCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+{{if .Spec.Doc}}{{comment .Spec.Doc}}{{else -}}
+// {{$f}} executes the {{.Spec.Command}} command with the executer
+// and returns its output files.
+{{end -}}
+func {{$f}}(ctx context.Context, executer rcom.Executer, p *{{$f}}Params) (*{{$f}}Result, error) {
+	command, err := p.Command()
+	if err != nil {
+		return nil, err
+	}
+	result, err := executer.Execute(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	r := &{{$f}}Result{Result: result}
+{{- range .Spec.OutputFiles}}
+{{- if .Multiple}}
+	r.{{.Name}} = result.FilesMatching({{quote .File}})
+{{- else}}
+	r.{{.Name}} = result.Files[{{quote .File}}]
+{{- end}}
+{{- if .Required}}
+	if r.{{.Name}} == nil {
+		return nil, fmt.Errorf("%s created no output file %q, callID=%v", {{quote $.Spec.Command}}, {{quote .File}}, result.CallID)
+	}
+{{- end}}
+{{- end}}
+	return r, nil
+}
+`))
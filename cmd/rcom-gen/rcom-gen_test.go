@@ -0,0 +1,53 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/domonda/go-rcom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generate(t *testing.T) {
+	specJSON := []byte(`{
+		"command": "tesseract",
+		"args": [
+			{"value": "input.png"},
+			{"value": "output"},
+			{"name": "Language", "flag": "-l", "required": true},
+			{"name": "PSM", "flag": "--psm", "type": "int", "min": 0, "max": 13},
+			{"name": "Scale", "flag": "--scale", "type": "float"},
+			{"name": "Config", "flag": "-c"},
+			{"name": "Quiet", "flag": "--quiet", "type": "bool"},
+			{"name": "Extra", "doc": "Extra is passed last"}
+		],
+		"inputFiles": [{"name": "Image", "file": "input.png", "required": true}],
+		"outputFiles": [
+			{"name": "Text", "file": "output.txt", "required": true},
+			{"name": "Pages", "file": "page-*.txt", "multiple": true}
+		]
+	}`)
+	spec, err := rcom.ParseCommandSpec(specJSON)
+	require.NoError(t, err)
+
+	source, err := generate(spec, specJSON, "tesseract.json", "ocr")
+	require.NoError(t, err)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "tesseract_rcom.go", source, 0)
+	require.NoError(t, err, "%s", source)
+	assert.Equal(t, "ocr", file.Name.Name)
+	assert.Contains(t, string(source), "func Tesseract(ctx context.Context, executer rcom.Executer, p *TesseractParams) (*TesseractResult, error)")
+	assert.Contains(t, string(source), `args = append(args, "-l", p.Language)`)
+	assert.Contains(t, string(source), `args = append(args, "--psm", strconv.Itoa(p.PSM))`)
+
+	// Type check the generated code to find template
+	// mistakes that still produce valid syntax
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check("ocr", fset, []*ast.File{file}, nil)
+	require.NoError(t, err, "%s", source)
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/domonda/go-rcom"
 	"github.com/domonda/golog/log"
+	"github.com/ungerik/go-fs"
 )
 
 func main() {
@@ -21,14 +23,28 @@ func main() {
 		portStr = "3666"
 	}
 
-	var port uint16
-	_, err := fmt.Sscanf(portStr, "%d", &port)
-	if err != nil {
-		log.Fatal("Can't scan port number").Err(err).LogAndPanic()
+	var err error
+	policy := rcom.NewPolicy()
+	if policyFile := os.Getenv("RCOM_POLICY"); policyFile != "" {
+		policy, err = rcom.LoadPolicyFile(fs.File(policyFile))
+		if err != nil {
+			log.Fatal("Can't load policy").Err(err).LogAndPanic()
+		}
 	}
 
-	log.Infof("Listening on port %d", port).Log()
-	err = rcom.ListenAndServe(port, true)
+	// Listen on a Unix domain socket for addresses like unix:///var/run/rcom.sock
+	addr := portStr
+	if !strings.HasPrefix(addr, "unix://") {
+		var port uint16
+		_, err = fmt.Sscanf(portStr, "%d", &port)
+		if err != nil {
+			log.Fatal("Can't scan port number").Err(err).LogAndPanic()
+		}
+		addr = fmt.Sprintf(":%d", port)
+	}
+
+	log.Infof("Listening on %s", addr).Log()
+	err = rcom.ListenAndServeAddr(addr, true, policy)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Server error").Err(err).LogAndPanic()
 	}
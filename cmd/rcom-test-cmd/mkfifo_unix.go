@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+func mkfifo(filename string) error {
+	return syscall.Mkfifo(filename, 0600)
+}
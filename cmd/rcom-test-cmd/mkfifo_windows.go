@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func mkfifo(filename string) error {
+	return errors.New("named pipes are not supported on windows")
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -13,10 +16,35 @@ func main() {
 	var (
 		wait        = flag.Duration("wait", time.Second, "duration until program end")
 		createFiles = flag.String("createFiles", "", "comma separated list of filenames to crete with random data")
+		symlinks    = flag.String("symlinks", "", "comma separated list of name:target symbolic links to create")
+		fifos       = flag.String("fifos", "", "comma separated list of named pipes (FIFOs) to create")
+		sockets     = flag.String("sockets", "", "comma separated list of unix domain sockets to create")
 		stdout      = flag.String("stdout", "", "write to stdout")
 		stderr      = flag.String("stderr", "", "write to stderr")
 		exitCode    = flag.Int("exitCode", 0, "status code on exit")
+		copyStdin   = flag.Bool("stdin", false, "copy stdin to stdout")
+		copyFiles   = flag.String("copy", "", "comma separated list of source:destination files to copy")
+		listen      = flag.String("listen", "", "unix domain socket to accept connections on until program end")
+		spawn       = flag.String("spawn", "", "start a sub-process that listens on the passed unix domain socket until program end")
 	)
+	flag.Parse()
+
+	if *listen != "" {
+		// Connections are accepted by the kernel
+		// as long as the process is alive
+		_, err := net.Listen("unix", *listen)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if *spawn != "" {
+		cmd := exec.Command(os.Args[0], "-wait="+wait.String(), "-listen="+*spawn)
+		err := cmd.Start()
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	time.Sleep(*wait)
 
@@ -24,7 +52,66 @@ func main() {
 		if filename == "" {
 			continue
 		}
-		err := ioutil.WriteFile(filename, nil, 0600)
+		err := os.MkdirAll(filepath.Dir(filename), 0700)
+		if err != nil {
+			panic(err)
+		}
+		err = os.WriteFile(filename, nil, 0600)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, cp := range strings.Split(*copyFiles, ",") {
+		if cp == "" {
+			continue
+		}
+		source, dest, _ := strings.Cut(cp, ":")
+		data, err := os.ReadFile(source)
+		if err != nil {
+			panic(err)
+		}
+		err = os.WriteFile(dest, data, 0600)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, link := range strings.Split(*symlinks, ",") {
+		if link == "" {
+			continue
+		}
+		name, target, _ := strings.Cut(link, ":")
+		err := os.Symlink(target, name)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, filename := range strings.Split(*fifos, ",") {
+		if filename == "" {
+			continue
+		}
+		err := mkfifo(filename)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, filename := range strings.Split(*sockets, ",") {
+		if filename == "" {
+			continue
+		}
+		// The socket file remains after exit
+		// because the listener is never closed
+		_, err := net.Listen("unix", filename)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if *copyStdin {
+		_, err := io.Copy(os.Stdout, os.Stdin)
 		if err != nil {
 			panic(err)
 		}
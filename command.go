@@ -4,36 +4,159 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/domonda/go-rcom/pkg/exec"
 )
 
 type Command struct {
-	Name               string
-	Args               []string
-	Stdin              []byte
-	Files              map[string][]byte
+	Name  string
+	Args  []string
+	Stdin []byte
+	// Env holds environment variables for the command
+	// in addition to the minimal base environment
+	// of the executing server, see BaseEnvVars.
+	Env []EnvVar
+	// Secrets references secrets held by the server
+	// that are passed to the command.
+	// Secret values are masked in the outputs of the Result.
+	Secrets []SecretRef
+	// Files are written to the working directory of the command.
+	// The map keys are relative slash separated paths
+	// like "input.tex" or "images/logo.png".
+	Files map[string][]byte
+	// ResultFilePatterns select the files of the working directory
+	// that are returned as Result.Files.
+	// Patterns without a slash like "*.pdf" only match files
+	// at the top level of the working directory.
+	// Patterns are matched per path element with path.Match,
+	// the element "**" matches zero or more directories
+	// like in "pages/**/*.png" or "**/*.pdf".
+	// All top level files are returned if there are no patterns.
 	ResultFilePatterns []string
+	// StdoutFile and StderrFile are optional paths of files
+	// in the working directory that the complete stdout and stderr
+	// of the command are written to independent of the output limit
+	// of the executing server. They can be returned as result files.
+	StdoutFile string
+	StderrFile string
 	// NonErrorExitCodes are non zero exit codes that should be returned
 	// as Result.ExitCode instead of being considered an error
 	NonErrorExitCodes map[int]bool
-	_                 struct{}
+	// Pipeline holds optional further commands
+	// that are executed like a shell pipeline without a shell.
+	// The stdout of every command is connected to the stdin
+	// of the next one, Stdin is only passed to the first command
+	// and StdoutFile only receives the stdout of the last command.
+	// The pipeline fails with a *PipelineError if any of its commands
+	// exits with an error exit code that is not in NonErrorExitCodes
+	// like a shell with pipefail does, except for commands
+	// killed by SIGPIPE because a later command like head
+	// exited before reading all of their output.
+	Pipeline []PipelineStage
+	// PTY executes the command with a pseudo-terminal
+	// for tools that require a terminal. The output of the
+	// command is returned as Result.Stdout and Result.Output.
+	// PTY can't be used with a Pipeline or a StderrFile
+	// and is only supported by servers running on Linux
+	// with a Policy that allows it for the command.
+	PTY *exec.PTY
+	_   struct{}
+}
+
+// PipelineStage is a command of a Command.Pipeline,
+// see Command.Pipeline for when a pipeline fails.
+type PipelineStage struct {
+	Name string
+	Args []string
+}
+
+func (s *PipelineStage) String() string {
+	if len(s.Args) == 0 {
+		return s.Name
+	}
+	return s.Name + " " + strings.Join(s.Args, " ")
 }
 
 func (c *Command) Validate() error {
 	if c.Name == "" {
 		return errors.New("rcom.Command: no command name provided")
 	}
+	for i, stage := range c.Pipeline {
+		if stage.Name == "" {
+			return fmt.Errorf("rcom.Command: no command name provided for pipeline stage %d", i+1)
+		}
+	}
+	if c.PTY != nil {
+		if len(c.Pipeline) > 0 {
+			return errors.New("rcom.Command: PTY can't be used with a Pipeline")
+		}
+		if c.StderrFile != "" {
+			return errors.New("rcom.Command: PTY can't be used with a StderrFile")
+		}
+	}
 	for fileName := range c.Files {
+		err := validateFilePath(fileName)
+		if err != nil {
+			return fmt.Errorf("rcom.Command: %w", err)
+		}
+	}
+	for _, fileName := range []string{c.StdoutFile, c.StderrFile} {
 		if fileName == "" {
-			return errors.New("rcom.Command: empty filename")
+			continue
 		}
-		if strings.ContainsAny(fileName, `/\`) {
-			return errors.New("rcom.Command: filename must not contain path separators")
+		err := validateFilePath(fileName)
+		if err != nil {
+			return fmt.Errorf("rcom.Command: %w", err)
+		}
+		if _, exists := c.Files[fileName]; exists {
+			return fmt.Errorf("rcom.Command: output file %q conflicts with input file", fileName)
+		}
+	}
+	if c.StdoutFile != "" && c.StdoutFile == c.StderrFile {
+		return errors.New("rcom.Command: StdoutFile and StderrFile must be different")
+	}
+	envNames := make(map[string]bool)
+	for _, v := range c.Env {
+		err := v.validate()
+		if err != nil {
+			return fmt.Errorf("rcom.Command: %w", err)
+		}
+		if envNames[v.Name] {
+			return fmt.Errorf("rcom.Command: duplicate environment variable %q", v.Name)
+		}
+		envNames[v.Name] = true
+	}
+	secretFiles := make(map[string]bool)
+	for i := range c.Secrets {
+		ref := &c.Secrets[i]
+		err := ref.validate()
+		if err != nil {
+			return fmt.Errorf("rcom.Command: %w", err)
+		}
+		if ref.EnvVar != "" {
+			if envNames[ref.EnvVar] {
+				return fmt.Errorf("rcom.Command: duplicate environment variable %q", ref.EnvVar)
+			}
+			envNames[ref.EnvVar] = true
+		}
+		if ref.FileName != "" {
+			if _, exists := c.Files[ref.FileName]; exists {
+				return fmt.Errorf("rcom.Command: secret file %q conflicts with input file", ref.FileName)
+			}
+			if ref.FileName == c.StdoutFile || ref.FileName == c.StderrFile {
+				return fmt.Errorf("rcom.Command: secret file %q conflicts with output file", ref.FileName)
+			}
+			if secretFiles[ref.FileName] {
+				return fmt.Errorf("rcom.Command: duplicate secret file %q", ref.FileName)
+			}
+			secretFiles[ref.FileName] = true
 		}
 	}
 	patterns := make(map[string]bool)
 	for _, pattern := range c.ResultFilePatterns {
-		if pattern == "" {
-			return errors.New("rcom.Command: empty result file pattern")
+		err := validateFilePattern(pattern)
+		if err != nil {
+			return fmt.Errorf("rcom.Command: %w", err)
 		}
 		if patterns[pattern] {
 			return fmt.Errorf("rcom.Command: duplicate result file pattern %q", pattern)
@@ -43,9 +166,23 @@ func (c *Command) Validate() error {
 	return nil
 }
 
+// names returns the names of the command
+// and of all its pipeline stages.
+func (c *Command) names() []string {
+	names := []string{c.Name}
+	for _, stage := range c.Pipeline {
+		names = append(names, stage.Name)
+	}
+	return names
+}
+
 func (c *Command) String() string {
-	if len(c.Args) == 0 {
-		return c.Name
+	s := c.Name
+	if len(c.Args) > 0 {
+		s += " " + strings.Join(c.Args, " ")
+	}
+	for i := range c.Pipeline {
+		s += " | " + c.Pipeline[i].String()
 	}
-	return c.Name + " " + strings.Join(c.Args, " ")
+	return s
 }
@@ -6,8 +6,10 @@ import (
 	"encoding/gob"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ungerik/go-fs"
 )
 
@@ -54,7 +56,7 @@ func Test_Command_ExecuteLocally(t *testing.T) {
 }
 
 func Test_Command_ExecuteRemotely(t *testing.T) {
-	svc := &service{map[string]bool{copyCmd(): true}}
+	svc := &service{policy: NewPolicy(copyCmd())}
 	server := httptest.NewServer(svc)
 	defer server.Close()
 
@@ -67,3 +69,37 @@ func Test_Command_ExecuteRemotely(t *testing.T) {
 	assert.True(t, ok, "expected result file exists")
 	assert.Equal(t, expectedFile.FileData, resultFileData, "result file has expected content")
 }
+
+func Test_ExecuteRemotely_Report(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer server.Close()
+
+	command, _ := cpCommand()
+	result, err := ExecuteRemotely(context.Background(), server.URL, command)
+	require.NoError(t, err)
+
+	report := result.Report
+	assert.False(t, report.Start.IsZero(), "report has start time")
+	assert.True(t, report.End.After(report.Start), "report end is after start")
+	assert.Greater(t, report.WallTime, time.Duration(0), "report has wall time")
+	assert.Greater(t, report.Phases.Decode, time.Duration(0), "report has decode phase")
+	assert.Greater(t, report.Phases.Exec, time.Duration(0), "report has exec phase")
+	assert.Greater(t, report.Phases.Encode, time.Duration(0), "report has encode phase from trailer")
+}
+
+func Test_Command_ExecuteLocally_NestedFiles(t *testing.T) {
+	command := &Command{
+		Name: copyCmd(),
+		Args: []string{"input/sub/input.txt", "output/sub/output.txt"},
+		Files: map[string][]byte{
+			"input/sub/input.txt": []byte("rcom test file"),
+			"output/sub/.keep":    nil,
+			"output/not-a-result": nil,
+		},
+		ResultFilePatterns: []string{"output/**/*.txt"},
+	}
+
+	result, _, err := ExecuteLocally(context.Background(), command)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"output/sub/output.txt": []byte("rcom test file")}, result.Files)
+}
@@ -1,8 +1,10 @@
 package rcom
 
 import (
+	"runtime"
 	"time"
 
+	"github.com/domonda/go-rcom/pkg/exec"
 	"github.com/domonda/golog"
 	rootlog "github.com/domonda/golog/log"
 )
@@ -10,6 +12,27 @@ import (
 var (
 	GracefulShutdownTimeout = time.Minute
 
+	// IdempotencyKeyTTL is how long a server keeps the result
+	// of a request with an idempotency key to return it
+	// for retries of the request without executing the command again.
+	IdempotencyKeyTTL = 10 * time.Minute
+
+	// IdempotencyMaxBytes limits the memory used by a server
+	// for the kept results of requests with an idempotency key.
+	// The oldest results are removed first when the limit is exceeded
+	// and larger results are not kept at all.
+	IdempotencyMaxBytes int64 = 256 << 20
+
+	// DefaultOutputLimit limits the outputs captured
+	// from executed commands to the first and last 4 MB
+	// if the Policy does not configure another limit.
+	DefaultOutputLimit = exec.OutputLimit{Head: 4 << 20, Tail: 4 << 20}
+
+	// DefaultBatchParallelism is the number of commands
+	// of a Batch that a server executes in parallel
+	// if the batch does not set MaxParallel.
+	DefaultBatchParallelism = runtime.NumCPU()
+
 	log = rootlog.NewPackageLogger()
 )
 
@@ -0,0 +1,168 @@
+package rcom
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Balancing is the strategy a Client uses
+// to pick one of multiple endpoints.
+type Balancing string
+
+const (
+	// BalanceRoundRobin picks the endpoints in turn
+	BalanceRoundRobin Balancing = "round-robin"
+
+	// BalanceLeastInFlight picks the endpoint
+	// with the fewest running requests of the Client
+	BalanceLeastInFlight Balancing = "least-in-flight"
+
+	// BalanceRandom picks a random endpoint
+	BalanceRandom Balancing = "random"
+)
+
+const (
+	// DefaultEjectAfterFailures is the default number of consecutive
+	// failures after which an endpoint is ejected
+	DefaultEjectAfterFailures = 3
+
+	// DefaultEjectDuration is the default duration
+	// for which a failed endpoint is ejected
+	DefaultEjectDuration = 30 * time.Second
+)
+
+// endpoint is a server of a Client
+// with its passive health state.
+type endpoint struct {
+	url string
+	// client for the URL which is derived from
+	// the HTTP client of the Client for Unix domain sockets
+	client *http.Client
+
+	// Guarded by endpoints.mtx
+	inFlight     int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// endpoints balances requests over multiple endpoints
+// and ejects endpoints that failed before a command started.
+type endpoints struct {
+	balancing     Balancing
+	ejectFailures int
+	ejectDuration time.Duration
+
+	mtx  sync.Mutex
+	list []*endpoint
+	next int
+}
+
+// endpointURL returns the URL for an endpoint
+// passed as "host:port" or as URL with scheme.
+func endpointURL(addr string) string {
+	if strings.Contains(addr, "://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+	return "http://" + addr
+}
+
+// pick returns an endpoint that is not in tried
+// or nil if all endpoints were tried.
+// Ejected endpoints are only picked
+// if all untried endpoints are ejected.
+// The in-flight count of the returned endpoint is incremented.
+func (e *endpoints) pick(tried map[*endpoint]bool) *endpoint {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	now := time.Now()
+	var healthy, ejected []*endpoint
+	for _, ep := range e.list {
+		switch {
+		case tried[ep]:
+		case now.Before(ep.ejectedUntil):
+			ejected = append(ejected, ep)
+		default:
+			healthy = append(healthy, ep)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = ejected
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var ep *endpoint
+	switch e.balancing {
+	case BalanceLeastInFlight:
+		for _, c := range candidates {
+			if ep == nil || c.inFlight < ep.inFlight {
+				ep = c
+			}
+		}
+	case BalanceRandom:
+		ep = candidates[rand.IntN(len(candidates))]
+	default:
+		ep = candidates[e.next%len(candidates)]
+		e.next++
+	}
+	ep.inFlight++
+	return ep
+}
+
+// done decrements the in-flight count of the endpoint
+// and updates its health with the result of the request.
+func (e *endpoints) done(ep *endpoint, failed bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	ep.inFlight--
+	if !failed {
+		ep.failures = 0
+		ep.ejectedUntil = time.Time{}
+		return
+	}
+	ep.failures++
+	if ep.failures >= e.ejectFailures {
+		ep.ejectedUntil = time.Now().Add(e.ejectDuration)
+	}
+}
+
+// isUnreachable returns if the error of a request
+// counts as failure for the ejection of the endpoint.
+// Overloaded endpoints that rejected a request with 429 or 503
+// are not ejected so that the pool does not shrink under load.
+func isUnreachable(err error) bool {
+	var statusErr *statusError
+	return errors.Is(err, ErrNotStarted) && !errors.As(err, &statusErr)
+}
+
+// release decrements the in-flight count of an endpoint
+// that was picked but not used for a request.
+func (e *endpoints) release(ep *endpoint) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	ep.inFlight--
+}
+
+// ejected returns the URLs of the currently ejected endpoints
+func (e *endpoints) ejected() []string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	var urls []string
+	now := time.Now()
+	for _, ep := range e.list {
+		if now.Before(ep.ejectedUntil) {
+			urls = append(urls, ep.url)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,87 @@
+package rcom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ungerik/go-fs"
+)
+
+func Test_endpoints_pick(t *testing.T) {
+	a, b, c := &endpoint{url: "a"}, &endpoint{url: "b"}, &endpoint{url: "c"}
+	e := &endpoints{ejectFailures: 2, ejectDuration: time.Minute, list: []*endpoint{a, b, c}}
+
+	// Round robin
+	for _, expected := range []*endpoint{a, b, c, a} {
+		ep := e.pick(nil)
+		assert.Equal(t, expected, ep)
+		e.done(ep, false)
+	}
+	assert.Equal(t, b, e.pick(map[*endpoint]bool{a: true}), "skip tried")
+	e.done(b, false)
+
+	// Ejection after two consecutive failures
+	e.done(e.pick(map[*endpoint]bool{b: true, c: true}), true)
+	assert.Empty(t, e.ejected())
+	a.inFlight++
+	e.done(a, true)
+	assert.Equal(t, []string{"a"}, e.ejected())
+	assert.Equal(t, b, e.pick(map[*endpoint]bool{c: true}), "skip ejected")
+	e.done(b, false)
+	assert.Equal(t, a, e.pick(map[*endpoint]bool{b: true, c: true}), "ejected if no other left")
+	e.done(a, false)
+	assert.Empty(t, e.ejected(), "success resets health")
+
+	// Least in flight
+	e.balancing = BalanceLeastInFlight
+	first, second := e.pick(nil), e.pick(nil)
+	assert.NotEqual(t, first, second)
+	third := e.pick(nil)
+	assert.NotEqual(t, first, third)
+	assert.NotEqual(t, second, third)
+}
+
+func Test_Client_Failover(t *testing.T) {
+	dead := httptest.NewServer(nil)
+	dead.Close()
+	live := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer live.Close()
+
+	client := NewClient(
+		ClientWithCmds(copyCmd()),
+		ClientWithEndpoints(dead.URL, live.URL),
+	)
+	input := fs.NewMemFile("input.txt", []byte("rcom test file"))
+	for range 2 * DefaultEjectAfterFailures {
+		result, err := client.ExecuteArgs(context.Background(), []string{"input.txt", "output.txt"}, []fs.FileReader{input}, "output.txt")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("rcom test file"), result.Files["output.txt"])
+	}
+	assert.Equal(t, []string{dead.URL}, client.EjectedEndpoints())
+}
+
+func Test_Client_Failover_overloaded(t *testing.T) {
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusTooManyRequests)
+	}))
+	defer overloaded.Close()
+	live := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer live.Close()
+
+	client := NewClient(
+		ClientWithCmds(copyCmd()),
+		ClientWithEndpoints(overloaded.URL, live.URL),
+		ClientWithEjection(1, time.Minute),
+	)
+	input := fs.NewMemFile("input.txt", []byte("rcom test file"))
+	for range 4 {
+		_, err := client.ExecuteArgs(context.Background(), []string{"input.txt", "output.txt"}, []fs.FileReader{input}, "output.txt")
+		require.NoError(t, err, "fails over to the live endpoint")
+	}
+	assert.Empty(t, client.EjectedEndpoints(), "overloaded endpoints are not ejected")
+}
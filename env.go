@@ -0,0 +1,84 @@
+package rcom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BaseEnvVars are the names of the environment variables
+// that executed commands inherit from the executing process.
+// All other variables of the executing process are not passed on.
+var BaseEnvVars = []string{"PATH", "LANG", "TZ"}
+
+// EnvVar is an environment variable for a Command.
+type EnvVar struct {
+	Name  string
+	Value string
+	// Sensitive marks variables whose value must never be logged
+	Sensitive bool
+}
+
+// String returns "Name=Value" with the value masked
+// if the variable is sensitive.
+func (v EnvVar) String() string {
+	if v.Sensitive {
+		return v.Name + "=***"
+	}
+	return v.Name + "=" + v.Value
+}
+
+func (v EnvVar) validate() error {
+	if v.Name == "" {
+		return errors.New("empty environment variable name")
+	}
+	if strings.ContainsAny(v.Name, "=\x00") {
+		return fmt.Errorf("invalid environment variable name %q", v.Name)
+	}
+	if strings.ContainsRune(v.Value, 0) {
+		return fmt.Errorf("environment variable %q contains a null byte", v.Name)
+	}
+	return nil
+}
+
+func envVarNames(vars []EnvVar) []string {
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// commandEnv returns the environment for a command
+// executed in workDir with tmpDir as temp directory.
+// The BaseEnvVars of the current process come first,
+// followed by HOME and TMPDIR and then the vars of the command.
+func commandEnv(workDir, tmpDir string, vars []EnvVar) []string {
+	env := make([]string, 0, len(BaseEnvVars)+2+len(vars))
+	for _, name := range BaseEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	env = append(env, "HOME="+workDir, "TMPDIR="+tmpDir)
+	for _, v := range vars {
+		env = append(env, v.Name+"="+v.Value)
+	}
+	return env
+}
+
+// matchEnvName returns if name matches one of the patterns
+// which are either variable names or name prefixes ending with "*".
+func matchEnvName(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
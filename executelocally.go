@@ -3,8 +3,11 @@ package rcom
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/domonda/go-rcom/pkg/exec"
@@ -12,7 +15,16 @@ import (
 	"github.com/ungerik/go-fs"
 )
 
+// ExecuteLocally executes the command on the local machine
+// in a temporary working directory without any Policy restrictions.
 func ExecuteLocally(ctx context.Context, c *Command) (result *Result, callID uu.ID, err error) {
+	return ExecuteLocallyWithPolicy(ctx, c, nil)
+}
+
+// ExecuteLocallyWithPolicy executes the command on the local machine
+// in a temporary working directory if it is allowed by the policy.
+// A nil policy allows all commands.
+func ExecuteLocallyWithPolicy(ctx context.Context, c *Command, policy *Policy) (result *Result, callID uu.ID, err error) {
 	start := time.Now()
 	// Every call gets a UUID
 	callID = uu.IDv7()
@@ -22,12 +34,52 @@ func ExecuteLocally(ctx context.Context, c *Command) (result *Result, callID uu.
 		Str("command", c.Name).
 		SubLogger()
 
-	log.Debug("ExecuteLocally").Log()
+	// Values of environment variables could be secrets
+	// even if they are not marked as sensitive
+	log.Debug("ExecuteLocally").
+		Strs("env", envVarNames(c.Env)).
+		Log()
 
 	err = c.Validate()
 	if err != nil {
 		return nil, callID, err
 	}
+	names := c.names()
+	for _, name := range names {
+		if !policy.Allows(name) {
+			return nil, callID, fmt.Errorf("command %q not allowed", name)
+		}
+		if c.PTY != nil && !policy.AllowsPTY(name) {
+			return nil, callID, fmt.Errorf("PTY not allowed for command %q", name)
+		}
+		for _, v := range c.Env {
+			if !policy.AllowsEnv(name, v.Name) {
+				return nil, callID, fmt.Errorf("environment variable %q not allowed for command %q", v.Name, name)
+			}
+		}
+	}
+	err = policy.checkSpec(c)
+	if err != nil {
+		return nil, callID, err
+	}
+
+	// Resolve referenced secrets
+	env := c.Env
+	secrets := make([][]byte, len(c.Secrets))
+	for i, ref := range c.Secrets {
+		// Every stage of a pipeline gets the same value
+		secrets[i], err = policy.secret(names, ref.Name)
+		if err != nil {
+			return nil, callID, err
+		}
+		if ref.EnvVar != "" {
+			env = append(env[:len(env):len(env)], EnvVar{Name: ref.EnvVar, Value: string(secrets[i]), Sensitive: true})
+		}
+	}
+	redactor := newRedactor(secrets)
+
+	var phases Phases
+	phaseStart := time.Now()
 
 	// Create unique temp working directory for call
 	dir := fs.TempDir().Join(callID.String())
@@ -43,30 +95,121 @@ func ExecuteLocally(ctx context.Context, c *Command) (result *Result, callID uu.
 		}
 	}()
 
+	// Temp directory of the command within the working dir
+	tmpDir := dir.Join("tmp")
+	err = tmpDir.MakeDir()
+	if err != nil {
+		return nil, callID, err
+	}
+
 	// Add files to working dir
 	for fileName, fileData := range c.Files {
-		err = dir.Join(fileName).WriteAllContext(ctx, fileData)
+		file := dir.Join(fileName)
+		err = file.Dir().MakeAllDirs()
+		if err == nil {
+			err = file.WriteAllContext(ctx, fileData)
+		}
 		if err != nil {
 			return nil, callID, fmt.Errorf("can't copy file %q because of error: %w", fileName, err)
 		}
 	}
 
+	// Add secret files to working dir
+	for i, ref := range c.Secrets {
+		if ref.FileName == "" {
+			continue
+		}
+		err = dir.Join(ref.FileName).WriteAllContext(ctx, secrets[i])
+		if err != nil {
+			return nil, callID, fmt.Errorf("can't write secret file %q because of error: %w", ref.FileName, err)
+		}
+	}
+
 	var stdin io.Reader
 	if len(c.Stdin) > 0 {
 		stdin = bytes.NewReader(c.Stdin)
 	}
 
-	r, err := exec.Command(c.Name, c.Args...).
-		WithDir(dir.MustLocalPath()).
-		WithStdin(stdin).
-		WithKillSubProcesses().
-		Run(ctx)
+	// Create directories for the output files
+	for _, fileName := range []string{c.StdoutFile, c.StderrFile} {
+		if fileName == "" {
+			continue
+		}
+		err = dir.Join(fileName).Dir().MakeAllDirs()
+		if err != nil {
+			return nil, callID, err
+		}
+	}
+
+	phases.WriteInputs = time.Since(phaseStart)
+	phaseStart = time.Now()
+
+	stages, usage, err := runCommand(ctx, c, policy, dir, commandEnv(dir.MustLocalPath(), tmpDir.MustLocalPath(), env), stdin)
 	if err != nil {
+		var stopped *exec.StoppedError
+		if errors.As(err, &stopped) {
+			log.Info("Stopped command").
+				Str("stage", string(stopped.Stage)).
+				Err(stopped.Err).
+				Log()
+			if stopped.Result != nil {
+				// Include the masked partial output
+				return nil, callID, fmt.Errorf("%w\nCommand output: %s", err, redactor.redact(stopped.Result.Output))
+			}
+		}
 		return nil, callID, err
 	}
+	phases.Exec = time.Since(phaseStart)
+	phaseStart = time.Now()
 
-	if r.ExitCode != 0 && (c.NonErrorExitCodes != nil || c.NonErrorExitCodes[r.ExitCode] == false) {
-		return nil, callID, fmt.Errorf("%w\nCommand output: %s", err, r.Output)
+	for _, stage := range stages {
+		stage.Output = redactor.redact(stage.Output)
+		stage.Stdout = redactor.redact(stage.Stdout)
+		stage.Stderr = redactor.redact(stage.Stderr)
+	}
+	r := stages[len(stages)-1]
+
+	// Secret files must not be returned as result files
+	for _, ref := range c.Secrets {
+		if ref.FileName == "" {
+			continue
+		}
+		err = dir.Join(ref.FileName).Remove()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, callID, fmt.Errorf("can't remove secret file %q because of error: %w", ref.FileName, err)
+		}
+	}
+
+	var stageResults []StageResult
+	var killedBySeccomp []string
+	if len(stages) > 1 {
+		stageResults = make([]StageResult, len(stages))
+		for i, stage := range stages {
+			stageResults[i] = StageResult{
+				Name:            names[i],
+				ExitCode:        stage.ExitCode,
+				Stderr:          stage.Stderr,
+				KilledBySeccomp: stage.KilledBySeccomp,
+				Signal:          stage.Signal,
+			}
+			if stage.KilledBySeccomp != "" {
+				killedBySeccomp = append(killedBySeccomp, stage.KilledBySeccomp)
+			}
+		}
+	}
+
+	for i, stage := range stages {
+		if i < len(stages)-1 && stage.Signal == "SIGPIPE" {
+			// A later command like head exited
+			// before reading all of the output
+			continue
+		}
+		if stage.ExitCode != 0 && !c.NonErrorExitCodes[stage.ExitCode] {
+			if stageResults != nil {
+				return nil, callID, &PipelineError{Stage: i, Stages: stageResults, ExitErr: stage.ExitError(), Output: stage.Output}
+			}
+			return nil, callID, fmt.Errorf("%s: %w\nCommand output: %s", names[i], stage.ExitError(), stage.Output)
+		}
 	}
 
 	result = &Result{
@@ -75,27 +218,99 @@ func ExecuteLocally(ctx context.Context, c *Command) (result *Result, callID uu.
 		Output:   r.Output,
 		Stdout:   r.Stdout,
 		Stderr:   r.Stderr,
-		Files:    make(map[string][]byte),
+
+		OutputTruncated: r.OutputTruncated,
+		StdoutTruncated: r.StdoutTruncated,
+		StderrTruncated: r.StderrTruncated,
+		StdoutBytes:     r.StdoutBytes,
+		StderrBytes:     r.StderrBytes,
+
+		KilledBySeccomp: r.KilledBySeccomp,
+		Signal:          r.Signal,
+		CoreDumped:      r.CoreDumped,
+		StopReason:      r.StopReason,
+	}
+	if stageResults != nil {
+		result.Stages = stageResults
+		result.KilledBySeccomp = strings.Join(killedBySeccomp, ",")
 	}
 
-	err = dir.ListDir(
-		func(file fs.File) error {
-			if file.IsDir() {
-				return nil
-			}
-			data, err := file.ReadAllContext(ctx)
-			if err != nil {
-				return err
-			}
-			result.Files[file.Name()] = data
-			return nil
-		},
-		c.ResultFilePatterns...,
-	)
+	result.Files, result.SkippedFiles, err = collectResultFiles(ctx, dir, c.ResultFilePatterns, tmpDir)
+	if err != nil {
+		return nil, callID, err
+	}
+	// The output files contain the unmasked output
+	for _, fileName := range []string{c.StdoutFile, c.StderrFile} {
+		if data, ok := result.Files[fileName]; ok && len(redactor) > 0 {
+			result.Files[fileName] = []byte(redactor.redact(string(data)))
+		}
+	}
+	phases.CollectResults = time.Since(phaseStart)
+	result.Report = Report{Usage: usage, Phases: phases}
+
+	for name, reason := range result.SkippedFiles {
+		log.Warn("Skipped result file").
+			Str("file", name).
+			Str("reason", reason).
+			Log()
+	}
 
 	log.Debug("ExecuteLocally finished").
 		Stringer("duration", time.Since(start)).
+		Stringer("userTime", usage.UserTime).
+		Stringer("systemTime", usage.SystemTime).
+		Int64("maxRSS", usage.MaxRSS).
 		Log()
 
 	return result, callID, nil
 }
+
+// runCommand runs the command or its pipeline with the passed
+// working directory, environment and stdin
+// and returns the results of all pipeline stages.
+func runCommand(ctx context.Context, c *Command, policy *Policy, dir fs.File, env []string, stdin io.Reader) (stages []*exec.Result, usage exec.Usage, err error) {
+	newCmd := func(name string, args []string) (*exec.Cmd, error) {
+		seccomp, err := policy.seccompProfiles(name)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(name, args...).
+			WithDir(dir.MustLocalPath()).
+			WithEnv(env).
+			WithKillSubProcesses().
+			WithSeccomp(seccomp...).
+			WithOutputLimit(policy.outputLimit())
+		return cmd, policy.applyStop(cmd)
+	}
+
+	cmd, err := newCmd(c.Name, c.Args)
+	if err != nil {
+		return nil, usage, err
+	}
+	cmd.WithStdin(stdin)
+	if c.PTY != nil {
+		cmd.WithPTY(*c.PTY)
+	}
+	if len(c.Pipeline) == 0 {
+		r, err := cmd.WithOutputFiles(c.StdoutFile, c.StderrFile).Run(ctx)
+		if err != nil {
+			return nil, usage, err
+		}
+		return []*exec.Result{r}, r.Usage, nil
+	}
+
+	cmds := []*exec.Cmd{cmd}
+	for _, stage := range c.Pipeline {
+		cmd, err = newCmd(stage.Name, stage.Args)
+		if err != nil {
+			return nil, usage, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	cmd.WithOutputFiles(c.StdoutFile, c.StderrFile)
+	r, err := exec.NewPipeline(cmds...).Run(ctx)
+	if err != nil {
+		return nil, usage, err
+	}
+	return r.Stages, r.Usage(), nil
+}
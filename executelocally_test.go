@@ -0,0 +1,91 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecuteLocallyWithPolicy_OutputLimit(t *testing.T) {
+	policy := NewPolicy(testCmd(t))
+	policy.OutputLimit = &exec.OutputLimit{Head: 5, Tail: 6}
+
+	command := &Command{
+		Name:               testCmd(t),
+		Args:               []string{"-wait=0", "-stdout=Hello truncated World"},
+		StdoutFile:         "log/stdout.txt",
+		ResultFilePatterns: []string{"log/*"},
+	}
+	result, _, err := ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	require.NoError(t, err)
+
+	assert.Equal(t, "HelloWorld\n", result.Stdout)
+	assert.True(t, result.StdoutTruncated)
+	assert.True(t, result.OutputTruncated)
+	assert.False(t, result.StderrTruncated)
+	assert.Equal(t, int64(len("Hello truncated World\n")), result.StdoutBytes)
+	assert.Equal(t, []byte("Hello truncated World\n"), result.Files["log/stdout.txt"], "complete output in file")
+}
+
+func Test_ExecuteLocallyWithPolicy_Pipeline(t *testing.T) {
+	command := &Command{
+		Name:  "sort",
+		Stdin: []byte("b\na\nc\n"),
+		Pipeline: []PipelineStage{
+			{Name: "head", Args: []string{"-n", "2"}},
+		},
+		StdoutFile:         "sorted.txt",
+		ResultFilePatterns: []string{"sorted.txt"},
+	}
+	assert.Equal(t, "sort | head -n 2", command.String())
+
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy("sort"))
+	assert.Error(t, err, "pipeline stage not allowed by policy")
+
+	result, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy("sort", "head"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", result.Stdout)
+	assert.Equal(t, []byte("a\nb\n"), result.Files["sorted.txt"])
+	require.Len(t, result.Stages, 2)
+	assert.Equal(t, "sort", result.Stages[0].Name)
+	assert.Equal(t, "head", result.Stages[1].Name)
+}
+
+func Test_ExecuteLocallyWithPolicy_PipelineSIGPIPE(t *testing.T) {
+	// head exits after the first line and seq
+	// is killed by SIGPIPE writing the rest
+	command := &Command{
+		Name:     "seq",
+		Args:     []string{"1", "1000000"},
+		Pipeline: []PipelineStage{{Name: "head", Args: []string{"-n", "1"}}},
+	}
+	result, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy("seq", "head"))
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", result.Stdout)
+	require.Len(t, result.Stages, 2)
+	assert.Equal(t, "SIGPIPE", result.Stages[0].Signal)
+	assert.Equal(t, 0, result.Stages[1].ExitCode)
+}
+
+func Test_ExecuteLocallyWithPolicy_PipelineError(t *testing.T) {
+	command := &Command{
+		Name:     "sh",
+		Args:     []string{"-c", "echo failing; exit 3"},
+		Pipeline: []PipelineStage{{Name: "cat"}},
+	}
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy("sh", "cat"))
+	var pipelineErr *PipelineError
+	require.ErrorAs(t, err, &pipelineErr)
+	assert.Equal(t, 0, pipelineErr.Stage)
+	require.Len(t, pipelineErr.Stages, 2)
+	assert.Equal(t, 3, pipelineErr.Stages[0].ExitCode)
+	assert.Equal(t, "cat", pipelineErr.Stages[1].Name)
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode)
+}
@@ -18,3 +18,12 @@ func LocalExecuter() Executer {
 		return result, err
 	})
 }
+
+// RemoteExecuter returns an Executer that executes commands
+// at the server with the passed address, see ClientWithBaseURL.
+// Like LocalExecuter it allows all commands, see ClientAllowAllCmds,
+// so only the Policy of the server restricts them.
+// The options can configure the returned Client further.
+func RemoteExecuter(addr string, opts ...ClientOption) Executer {
+	return NewClient(append([]ClientOption{ClientWithBaseURL(addr), ClientAllowAllCmds()}, opts...)...)
+}
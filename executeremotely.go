@@ -4,14 +4,71 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/domonda/go-types/uu"
 )
 
+// ErrNotStarted is wrapped by errors of ExecuteRemotely
+// if the server could not be reached or did not start
+// the command, so executing it at another server is safe.
+var ErrNotStarted = errors.New("command not started")
+
+// statusError is returned by post for responses
+// with another status than http.StatusOK.
+type statusError struct {
+	code   int
+	status string
+	// err is ErrNotStarted, a *PipelineError,
+	// an *exec.ExitError or nil
+	err error
+}
+
+func (e *statusError) Error() string {
+	if e.err == nil {
+		return "rcom.Command: response status " + e.status
+	}
+	return fmt.Sprintf("rcom.Command: response status %s: %s", e.status, e.err)
+}
+
+func (e *statusError) Unwrap() error { return e.err }
+
+// responseError wraps errors that occurred after the headers
+// of a successful response were received.
+// They are not retryable because the command was executed.
+type responseError struct {
+	err error
+}
+
+func (e *responseError) Error() string { return e.err.Error() }
+
+func (e *responseError) Unwrap() error { return e.err }
+
+// ExecuteRemotely executes the command at the server
+// with the passed address without retries.
+// The address is either a URL like "http://host:port/prefix",
+// "host:port", or a Unix domain socket address
+// like "unix:///var/run/rcom.sock".
 func ExecuteRemotely(ctx context.Context, addr string, c *Command) (result *Result, err error) {
+	return executeRemotely(ctx, nil, addr, c, uu.IDv7().String(), nil)
+}
+
+// executeRemotely executes the command with the HTTP client
+// which defaults to http.DefaultClient if nil.
+// If dest is not nil then the result files are streamed
+// into its directory instead of returned in Result.Files.
+func executeRemotely(ctx context.Context, client *http.Client, addr string, c *Command, idempotencyKey string, dest *filesDestination) (result *Result, err error) {
 	log.Debug("ExecuteRemotely").
 		Str("addr", addr).
 		Str("command", c.Name).
+		Str("correlationID", correlationIDFromContext(ctx)).
 		Log()
 
 	err = c.Validate()
@@ -25,25 +82,90 @@ func ExecuteRemotely(ctx context.Context, addr string, c *Command) (result *Resu
 		return nil, err
 	}
 
-	request, err := http.NewRequestWithContext(ctx, "POST", addr, buf)
+	header := http.Header{}
+	header.Set(idempotencyKeyHeader, idempotencyKey)
+	if dest != nil {
+		header.Set("Accept", streamFilesContentType)
+	}
+	response, err := post(ctx, client, addr, "", buf, header)
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
+	defer func() {
+		if err != nil {
+			err = &responseError{err: err}
+		}
+	}()
 
-	response, err := http.DefaultClient.Do(request)
+	if dest != nil {
+		result, err = dest.decodeStreamedFiles(response)
+	} else {
+		err = gob.NewDecoder(response.Body).Decode(&result)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("rcom.Command: response status %s", response.Status)
+	// Trailers are available after the body was read completely
+	_, err = io.Copy(io.Discard, response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if encode := response.Trailer.Get(encodeDurationTrailer); encode != "" {
+		result.Report.Phases.Encode, _ = time.ParseDuration(encode)
 	}
 
-	defer response.Body.Close()
-	err = gob.NewDecoder(response.Body).Decode(&result)
+	return result, nil
+}
+
+// post sends a POST request with the body to the server
+// with the passed address and the path appended to its URL.
+// The correlation ID of the context is sent with the request.
+// Errors wrap ErrNotStarted if the server could not be reached
+// or did not start the request, and an *exec.ExitError
+// if the server responded with one.
+// The body of the returned response has to be closed.
+func post(ctx context.Context, client *http.Client, addr, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	url, client, err := httpClientFor(client, addr)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if id := correlationIDFromContext(ctx); id != "" {
+		request.Header.Set(correlationIDHeader, id)
+	}
+
+	response, err := client.Do(request)
 	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, fmt.Errorf("%w: %w", ErrNotStarted, err)
+		}
 		return nil, err
 	}
+	if response.StatusCode == http.StatusOK {
+		return response, nil
+	}
+	defer response.Body.Close()
 
-	return result, nil
+	statusErr := &statusError{code: response.StatusCode, status: response.Status}
+	pipelineErr := new(PipelineError)
+	if response.StatusCode == http.StatusServiceUnavailable || response.StatusCode == http.StatusTooManyRequests {
+		statusErr.err = ErrNotStarted
+	} else if response.Header.Get(pipelineErrorHeader) != "" && gob.NewDecoder(response.Body).Decode(pipelineErr) == nil {
+		statusErr.err = pipelineErr
+	} else if header := response.Header.Get(exitErrorHeader); header != "" {
+		exitErr := new(exec.ExitError)
+		if json.Unmarshal([]byte(header), exitErr) == nil {
+			statusErr.err = exitErr
+		}
+	}
+	return nil, statusErr
 }
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecuteRemotely_ExitError(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy("sh")})
+	defer server.Close()
+
+	command := &Command{
+		Name:              "sh",
+		Args:              []string{"-c", "exit 3"},
+		NonErrorExitCodes: map[int]bool{3: true},
+	}
+	result, err := ExecuteRemotely(context.Background(), server.URL, command)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+
+	command.Args = []string{"-c", "kill -SEGV $$"}
+	_, err = ExecuteRemotely(context.Background(), server.URL, command)
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, -1, exitErr.ExitCode)
+	assert.Equal(t, "SIGSEGV", exitErr.Signal)
+}
+
+func Test_ExecuteRemotely_PipelineError(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy("sh", "cat")})
+	defer server.Close()
+
+	command := &Command{
+		Name:     "sh",
+		Args:     []string{"-c", "exit 3"},
+		Pipeline: []PipelineStage{{Name: "cat"}},
+	}
+	_, err := ExecuteRemotely(context.Background(), server.URL, command)
+	var pipelineErr *PipelineError
+	require.ErrorAs(t, err, &pipelineErr)
+	require.Len(t, pipelineErr.Stages, 2)
+	assert.Equal(t, 3, pipelineErr.Stages[0].ExitCode)
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode)
+}
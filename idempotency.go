@@ -0,0 +1,114 @@
+package rcom
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader is the HTTP header used by clients
+// to send a key that is identical for all retries of a request
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// errIdempotencyKeyReused is returned for a request
+// that reuses the idempotency key of a different request
+var errIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// execution is the shared outcome of requests with the same idempotency key
+type execution struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	// done is closed after result and err are set
+	done    chan struct{}
+	result  *Result
+	err     error
+	size    int64
+	expires time.Time
+}
+
+// executions deduplicates requests by their idempotency key
+// so that retried requests wait for or return the outcome
+// of the first request instead of executing the command again.
+type executions struct {
+	mtx  sync.Mutex
+	keys map[string]*execution
+	// finished executions in the order of their expiry
+	finished []*execution
+	// size of the results of the finished executions
+	size int64
+}
+
+// begin returns the execution for the key and if it is new,
+// in which case the caller has to call finish or abort.
+func (e *executions) begin(key string, fingerprint [sha256.Size]byte) (exe *execution, isNew bool, err error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.prune(time.Now(), IdempotencyMaxBytes)
+
+	if exe = e.keys[key]; exe != nil {
+		if exe.fingerprint != fingerprint {
+			return nil, false, errIdempotencyKeyReused
+		}
+		return exe, false, nil
+	}
+	if e.keys == nil {
+		e.keys = make(map[string]*execution)
+	}
+	exe = &execution{key: key, fingerprint: fingerprint, done: make(chan struct{})}
+	e.keys[key] = exe
+	return exe, true, nil
+}
+
+// finish sets the outcome of the execution
+// and keeps it for IdempotencyKeyTTL.
+// Older outcomes are removed if the results
+// of all kept outcomes exceed IdempotencyMaxBytes.
+func (e *executions) finish(exe *execution, result *Result, err error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	exe.result, exe.err = result, err
+	exe.size = result.size()
+	exe.expires = time.Now().Add(IdempotencyKeyTTL)
+	close(exe.done)
+
+	if exe.size > IdempotencyMaxBytes {
+		// Too large to be kept, requests that
+		// are already waiting still get the result
+		delete(e.keys, exe.key)
+		return
+	}
+	e.prune(time.Now(), IdempotencyMaxBytes-exe.size)
+	e.finished = append(e.finished, exe)
+	e.size += exe.size
+}
+
+// prune removes the finished executions that expired
+// and the oldest ones until their size is at most maxSize.
+func (e *executions) prune(now time.Time, maxSize int64) {
+	n := 0
+	for ; n < len(e.finished); n++ {
+		exe := e.finished[n]
+		if now.Before(exe.expires) && e.size <= maxSize {
+			break
+		}
+		delete(e.keys, exe.key)
+		e.size -= exe.size
+		e.finished[n] = nil
+	}
+	e.finished = e.finished[n:]
+}
+
+// abort removes an execution that did not start or complete
+// the command so that a retry with the same key can start it.
+// Requests waiting for an aborted execution
+// get neither a result nor an error.
+func (e *executions) abort(exe *execution) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	delete(e.keys, exe.key)
+	close(exe.done)
+}
@@ -0,0 +1,128 @@
+package rcom
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_executions_prune(t *testing.T) {
+	defer func(ttl time.Duration, maxBytes int64) {
+		IdempotencyKeyTTL, IdempotencyMaxBytes = ttl, maxBytes
+	}(IdempotencyKeyTTL, IdempotencyMaxBytes)
+	IdempotencyMaxBytes = 10
+
+	var e executions
+	begin := func(key string) *execution {
+		t.Helper()
+		exe, isNew, err := e.begin(key, [sha256.Size]byte{})
+		require.NoError(t, err)
+		require.True(t, isNew, key)
+		return exe
+	}
+
+	e.finish(begin("a"), &Result{Stdout: "12345"}, nil)
+	e.finish(begin("b"), &Result{Stdout: "123456"}, nil)
+	assert.NotContains(t, e.keys, "a", "oldest result removed for size limit")
+	assert.Contains(t, e.keys, "b")
+
+	c := begin("c")
+	e.finish(c, &Result{Stdout: "12345678901"}, nil)
+	<-c.done
+	assert.Equal(t, "12345678901", c.result.Stdout, "waiting requests get the result")
+	assert.NotContains(t, e.keys, "c", "result larger than limit not kept")
+	assert.Contains(t, e.keys, "b")
+	assert.Equal(t, int64(6), e.size)
+
+	e = executions{}
+	IdempotencyKeyTTL = 50 * time.Millisecond
+	e.finish(begin("d"), nil, errors.New("failed"))
+	time.Sleep(60 * time.Millisecond)
+	e.finish(begin("e"), nil, errors.New("failed"))
+	begin("f")
+	assert.NotContains(t, e.keys, "d", "expired")
+	assert.Contains(t, e.keys, "e", "not expired")
+}
+
+func Test_service_IdempotencyKey_canceled(t *testing.T) {
+	started := make(chan struct{})
+	var calls atomic.Int32
+	handler, err := NewHandler(NewPolicy(copyCmd()), func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return next.Execute(ctx, command)
+		})
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	command, expectedFile := cpCommand()
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := executeRemotely(ctx, nil, server.URL, command, "key", nil)
+		canceled <- err
+	}()
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+
+	// A retry after the connection of the first request failed
+	// executes the command instead of getting the cancel error
+	retried, err := executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, retried.Files[expectedFile.Name()])
+	assert.Equal(t, int32(2), calls.Load())
+
+	again, err := executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, retried.CallID, again.CallID)
+}
+
+func Test_service_IdempotencyKey_canceledAfterCompletion(t *testing.T) {
+	executed := make(chan struct{})
+	var calls atomic.Int32
+	handler, err := NewHandler(NewPolicy(copyCmd()), func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			result, err := next.Execute(ctx, command)
+			if calls.Add(1) == 1 {
+				// The request is canceled after the command completed
+				close(executed)
+				<-ctx.Done()
+			}
+			return result, err
+		})
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	command, expectedFile := cpCommand()
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := executeRemotely(ctx, nil, server.URL, command, "key", nil)
+		canceled <- err
+	}()
+	<-executed
+	cancel()
+	assert.ErrorIs(t, <-canceled, context.Canceled)
+
+	// The retry gets the kept result without executing the command again
+	retried, err := executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, retried.Files[expectedFile.Name()])
+	assert.Equal(t, int32(1), calls.Load())
+}
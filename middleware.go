@@ -0,0 +1,154 @@
+package rcom
+
+import (
+	"context"
+	"time"
+
+	"github.com/domonda/golog"
+)
+
+// Middleware wraps an Executer to add behavior
+// around the execution of commands.
+type Middleware func(Executer) Executer
+
+// Chain returns the executer wrapped by the middlewares.
+// The first middleware is the outermost one
+// that is called first for every execution.
+func Chain(executer Executer, middlewares ...Middleware) Executer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		executer = middlewares[i](executer)
+	}
+	return executer
+}
+
+// LoggingMiddleware logs every execution with its duration
+// and the error if it failed.
+// The logger of the package is used if logger is nil.
+func LoggingMiddleware(logger *golog.Logger) Middleware {
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			l := logger
+			if l == nil {
+				l = log
+			}
+			start := time.Now()
+			result, err := next.Execute(ctx, command)
+			if err != nil {
+				l.Error("Command execution failed").
+					Str("command", command.Name).
+					Str("correlationID", correlationIDFromContext(ctx)).
+					Stringer("duration", time.Since(start)).
+					Err(err).
+					Log()
+				return result, err
+			}
+			msg := l.Info("Command executed").
+				Str("command", command.Name).
+				Str("correlationID", correlationIDFromContext(ctx))
+			// A nil result is rejected after the whole chain
+			if result != nil {
+				msg = msg.
+					UUID("callID", result.CallID).
+					Int("exitCode", result.ExitCode)
+			}
+			msg.Stringer("duration", time.Since(start)).
+				Log()
+			return result, nil
+		})
+	}
+}
+
+// TimeoutMiddleware cancels executions
+// that take longer than timeout.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next.Execute(ctx, command)
+		})
+	}
+}
+
+// RetryMiddleware retries executions that failed
+// with a retryable error, see IsRetryable.
+// In contrast to ClientWithRetry every attempt is a new request,
+// so a server could execute a command more than once.
+func RetryMiddleware(retry RetryPolicy) Middleware {
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			return retry.retry(ctx, func() (*Result, error) {
+				return next.Execute(ctx, command)
+			})
+		})
+	}
+}
+
+// ConcurrencyLimitMiddleware limits the number of parallel executions.
+// Further executions wait until an execution finished
+// or their context is canceled.
+// The limit is shared by all executers wrapped
+// by the same returned Middleware.
+// A limit of zero or less does not limit executions.
+func ConcurrencyLimitMiddleware(limit int) Middleware {
+	if limit <= 0 {
+		return func(next Executer) Executer { return next }
+	}
+	slots := make(chan struct{}, limit)
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return next.Execute(ctx, command)
+		})
+	}
+}
+
+// ExecutionMetrics describes a finished execution
+// for MetricsMiddleware.
+type ExecutionMetrics struct {
+	Command  string
+	Duration time.Duration
+	// Result is nil if Err is not nil
+	Result *Result
+	Err    error
+}
+
+// MetricsMiddleware calls observe after every execution,
+// for example to update Prometheus counters and histograms.
+func MetricsMiddleware(observe func(ExecutionMetrics)) Middleware {
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			start := time.Now()
+			result, err := next.Execute(ctx, command)
+			observe(ExecutionMetrics{
+				Command:  command.Name,
+				Duration: time.Since(start),
+				Result:   result,
+				Err:      err,
+			})
+			return result, err
+		})
+	}
+}
+
+// RewriteMiddleware executes the command returned by rewrite
+// instead of the passed command, for example to add arguments,
+// environment variables or to map command names.
+// rewrite must not modify the passed command
+// and the execution fails if it returns an error.
+func RewriteMiddleware(rewrite func(*Command) (*Command, error)) Middleware {
+	return func(next Executer) Executer {
+		return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			command, err := rewrite(command)
+			if err != nil {
+				return nil, err
+			}
+			return next.Execute(ctx, command)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package rcom
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Chain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Executer) Executer {
+			return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+				order = append(order, name)
+				return next.Execute(ctx, command)
+			})
+		}
+	}
+	var metrics []ExecutionMetrics
+	executer := Chain(
+		ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			order = append(order, command.Name)
+			return new(Result), nil
+		}),
+		trace("outer"),
+		MetricsMiddleware(func(m ExecutionMetrics) { metrics = append(metrics, m) }),
+		RewriteMiddleware(func(command *Command) (*Command, error) {
+			return &Command{Name: "rewritten"}, nil
+		}),
+		trace("inner"),
+	)
+	_, err := executer.Execute(context.Background(), &Command{Name: "cmd"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "rewritten"}, order)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "cmd", metrics[0].Command)
+}
+
+func Test_LoggingMiddleware_nilResult(t *testing.T) {
+	executer := LoggingMiddleware(nil)(ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+		return nil, nil
+	}))
+	result, err := executer.Execute(context.Background(), &Command{Name: "cmd"})
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func Test_TimeoutMiddleware(t *testing.T) {
+	executer := Chain(
+		ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+		TimeoutMiddleware(10*time.Millisecond),
+	)
+	_, err := executer.Execute(context.Background(), &Command{Name: "cmd"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_RetryMiddleware(t *testing.T) {
+	var attempts int
+	executer := Chain(
+		ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, ErrNotStarted
+			}
+			return new(Result), nil
+		}),
+		RetryMiddleware(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	_, err := executer.Execute(context.Background(), &Command{Name: "cmd"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func Test_ConcurrencyLimitMiddleware(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	executer := Chain(
+		ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return new(Result), nil
+		}),
+		ConcurrencyLimitMiddleware(2),
+	)
+	done := make(chan struct{})
+	for range 6 {
+		go func() {
+			executer.Execute(context.Background(), &Command{Name: "cmd"})
+			done <- struct{}{}
+		}()
+	}
+	for range 6 {
+		<-done
+	}
+	assert.Equal(t, int32(2), maxRunning.Load())
+
+	// Limits of zero or less don't limit
+	for _, limit := range []int{0, -1} {
+		executer := Chain(
+			ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+				return new(Result), nil
+			}),
+			ConcurrencyLimitMiddleware(limit),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := executer.Execute(ctx, &Command{Name: "cmd"})
+		cancel()
+		assert.NoError(t, err, "limit %d", limit)
+	}
+}
+
+func Test_NewHandler_Middlewares(t *testing.T) {
+	handler, err := NewHandler(
+		NewPolicy(copyCmd()),
+		RewriteMiddleware(func(command *Command) (*Command, error) {
+			c := *command
+			c.Args = []string{"input.txt", "rewritten.txt"}
+			return &c, nil
+		}),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	command, expectedFile := cpCommand()
+	result, err := ExecuteRemotely(context.Background(), server.URL, command)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, result.Files["rewritten.txt"])
+	assert.NotContains(t, result.Files, expectedFile.Name())
+}
@@ -0,0 +1,85 @@
+package rcom
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"path"
+	"strings"
+)
+
+// validateFilePath checks that name is a relative, slash separated path
+// without empty, "." or ".." elements that can't escape the working directory.
+func validateFilePath(name string) error {
+	switch {
+	case name == "":
+		return errors.New("empty filename")
+	case strings.Contains(name, `\`):
+		return fmt.Errorf("filename %q must use forward slashes as path separators", name)
+	case name == "." || !iofs.ValidPath(name):
+		return fmt.Errorf("filename %q must be a relative path within the working directory", name)
+	}
+	return nil
+}
+
+// validateFilePattern checks that pattern is a valid
+// slash separated result file pattern.
+func validateFilePattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("empty result file pattern")
+	}
+	if strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("result file pattern %q must be relative", pattern)
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		switch elem {
+		case "", ".", "..":
+			return fmt.Errorf("result file pattern %q has invalid element %q", pattern, elem)
+		case "**":
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("invalid result file pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isRecursiveFilePattern returns if the pattern
+// can match files in sub directories.
+func isRecursiveFilePattern(pattern string) bool {
+	return strings.Contains(pattern, "/") || strings.Contains(pattern, "**")
+}
+
+// matchFilePattern matches the slash separated relative
+// file path name against pattern.
+// Every pattern path element is matched with path.Match
+// except "**" which matches zero or more directories.
+func matchFilePattern(pattern, name string) bool {
+	return matchPathElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchPathElems(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
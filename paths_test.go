@@ -0,0 +1,51 @@
+package rcom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateFilePath(t *testing.T) {
+	for _, name := range []string{"a.txt", "images/logo.png", "a/b/c/d.tex", ".hidden"} {
+		assert.NoError(t, validateFilePath(name), name)
+	}
+	for _, name := range []string{"", ".", "..", "/etc/passwd", "../a", "a/../../b", "a/./b", "a//b", "a/", `a\b`, `..\a`} {
+		assert.Error(t, validateFilePath(name), name)
+	}
+}
+
+func Test_validateFilePattern(t *testing.T) {
+	for _, pattern := range []string{"*", "*.pdf", "**", "**/*.png", "out/**", "pages/*/p[0-9].png"} {
+		assert.NoError(t, validateFilePattern(pattern), pattern)
+	}
+	for _, pattern := range []string{"", "/out/*", "../*", "a//b", "[", "a/./b"} {
+		assert.Error(t, validateFilePattern(pattern), pattern)
+	}
+}
+
+func Test_matchFilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "dir/a.txt", false},
+		{"**", "a.txt", true},
+		{"**", "dir/sub/a.txt", true},
+		{"**/*.txt", "a.txt", true},
+		{"**/*.txt", "dir/sub/a.txt", true},
+		{"**/*.txt", "dir/sub/a.pdf", false},
+		{"out/**", "out/a.txt", true},
+		{"out/**", "out/sub/a.txt", true},
+		{"out/**", "other/a.txt", false},
+		{"out/**/page-*.png", "out/page-1.png", true},
+		{"out/**/page-*.png", "out/1/2/page-1.png", true},
+		{"out/*/page-*.png", "out/1/2/page-1.png", false},
+		{"out/*/page-*.png", "out/1/page-1.png", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, matchFilePattern(tt.pattern, tt.name), "%s %s", tt.pattern, tt.name)
+	}
+}
@@ -0,0 +1,202 @@
+package exec
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// OutputLimit limits the captured output of a stream
+// to its first Head and last Tail bytes.
+// A zero OutputLimit does not limit the captured output.
+type OutputLimit struct {
+	Head int `json:"head"`
+	Tail int `json:"tail"`
+}
+
+// IsZero returns if the limit does not limit the output
+func (l OutputLimit) IsZero() bool {
+	return l.Head <= 0 && l.Tail <= 0
+}
+
+// limitedBuffer keeps the first head and the last tail bytes written to it.
+// It only counts the written bytes if discard is true.
+type limitedBuffer struct {
+	limit   OutputLimit
+	discard bool
+	head    []byte
+	tail    []byte
+	total   int64
+}
+
+func (b *limitedBuffer) Write(p []byte) {
+	b.total += int64(len(p))
+	if b.discard {
+		return
+	}
+	if b.limit.IsZero() {
+		b.head = append(b.head, p...)
+		return
+	}
+	if n := min(b.limit.Head-len(b.head), len(p)); n > 0 {
+		b.head = append(b.head, p[:n]...)
+		p = p[n:]
+	}
+	if len(p) == 0 || b.limit.Tail <= 0 {
+		return
+	}
+	b.tail = append(b.tail, p...)
+	// Compact only when twice the limit is reached
+	// to amortize copying
+	if len(b.tail) > 2*b.limit.Tail {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-b.limit.Tail:]...)
+	}
+}
+
+func (b *limitedBuffer) String() string {
+	if len(b.tail) > b.limit.Tail {
+		return string(b.head) + string(b.tail[len(b.tail)-b.limit.Tail:])
+	}
+	return string(b.head) + string(b.tail)
+}
+
+func (b *limitedBuffer) Truncated() bool {
+	if b.discard {
+		return false
+	}
+	return b.total > int64(len(b.head)+min(len(b.tail), b.limit.Tail))
+}
+
+// Stream names an output stream of a process
+type Stream string
+
+const (
+	StreamStdout Stream = "stdout"
+	StreamStderr Stream = "stderr"
+)
+
+// maxLineLength is the length after which
+// a line without newline is passed to a line callback
+const maxLineLength = 64 << 10
+
+// Line is a line of output of a process
+// passed to the callback set with Cmd.WithLineCallback.
+type Line struct {
+	// Stream the line was written to
+	Stream Stream
+	// Time when the line was complete
+	Time time.Time
+	// Seq is the zero based number of the line
+	// across both streams in the order they were written
+	Seq int
+	// Text of the line without the trailing newline
+	Text string
+}
+
+type outputStream struct {
+	name   Stream
+	buf    limitedBuffer
+	writer io.Writer
+	// partial line not yet passed to onLine
+	partial []byte
+}
+
+// outputCapture captures stdout and stderr of a process
+// separately and combined in the order they were written
+// and passes the output on to optional writers and a line callback.
+// Writes are serialized so that the writers and the callback
+// are never called concurrently.
+type outputCapture struct {
+	mtx      sync.Mutex
+	stdout   outputStream
+	stderr   outputStream
+	combined limitedBuffer
+	onLine   func(Line)
+	lineSeq  int
+}
+
+func (c *Cmd) newOutputCapture() *outputCapture {
+	return &outputCapture{
+		stdout:   outputStream{name: StreamStdout, buf: limitedBuffer{limit: c.outputLimit, discard: c.noCapture}, writer: c.stdout},
+		stderr:   outputStream{name: StreamStderr, buf: limitedBuffer{limit: c.outputLimit, discard: c.noCapture}, writer: c.stderr},
+		combined: limitedBuffer{limit: c.outputLimit, discard: c.noCapture},
+		onLine:   c.onLine,
+	}
+}
+
+func (c *outputCapture) write(s *outputStream, p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s.buf.Write(p)
+	c.combined.Write(p)
+	if c.onLine != nil {
+		c.splitLines(s, p)
+	}
+	if s.writer != nil {
+		return s.writer.Write(p)
+	}
+	return len(p), nil
+}
+
+func (c *outputCapture) splitLines(s *outputStream, p []byte) {
+	s.partial = append(s.partial, p...)
+	rest := s.partial
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			if len(rest) < maxLineLength {
+				break
+			}
+			i = maxLineLength
+			c.emitLine(s.name, rest[:i])
+			rest = rest[i:]
+			continue
+		}
+		c.emitLine(s.name, bytes.TrimSuffix(rest[:i], []byte{'\r'}))
+		rest = rest[i+1:]
+	}
+	s.partial = append(s.partial[:0], rest...)
+}
+
+func (c *outputCapture) emitLine(stream Stream, text []byte) {
+	c.onLine(Line{Stream: stream, Time: time.Now(), Seq: c.lineSeq, Text: string(text)})
+	c.lineSeq++
+}
+
+// flushLines passes incomplete last lines to the line callback
+func (c *outputCapture) flushLines() {
+	if c.onLine == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, s := range []*outputStream{&c.stdout, &c.stderr} {
+		if len(s.partial) > 0 {
+			c.emitLine(s.name, s.partial)
+			s.partial = nil
+		}
+	}
+}
+
+// Stdout returns a writer for the stdout stream
+func (c *outputCapture) Stdout() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		return c.write(&c.stdout, p)
+	})
+}
+
+// Stderr returns a writer for the stderr stream
+func (c *outputCapture) Stderr() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		return c.write(&c.stderr, p)
+	})
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
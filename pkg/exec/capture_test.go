@@ -0,0 +1,33 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_limitedBuffer(t *testing.T) {
+	tests := []struct {
+		limit     OutputLimit
+		writes    []string
+		expected  string
+		truncated bool
+	}{
+		{OutputLimit{}, []string{"Hello", " ", "World"}, "Hello World", false},
+		{OutputLimit{Head: 5, Tail: 5}, []string{"Hello", " ", "World"}, "HelloWorld", true},
+		{OutputLimit{Head: 5, Tail: 6}, []string{"Hello", " ", "World"}, "Hello World", false},
+		{OutputLimit{Head: 20, Tail: 5}, []string{"Hello", " ", "World"}, "Hello World", false},
+		{OutputLimit{Head: 3}, []string{"Hello", " ", "World"}, "Hel", true},
+		{OutputLimit{Tail: 3}, []string{"Hello", " ", "World"}, "rld", true},
+		{OutputLimit{Head: 1, Tail: 2}, []string{"H", "e", "l", "l", "o", " ", "W", "o", "r", "l", "d"}, "Hld", true},
+	}
+	for _, tt := range tests {
+		b := limitedBuffer{limit: tt.limit}
+		for _, w := range tt.writes {
+			b.Write([]byte(w))
+		}
+		assert.Equal(t, tt.expected, b.String(), "%+v", tt.limit)
+		assert.Equal(t, tt.truncated, b.Truncated(), "%+v", tt.limit)
+		assert.Equal(t, int64(len("Hello World")), b.total, "%+v", tt.limit)
+	}
+}
@@ -11,14 +11,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
-	"strings"
+	"path/filepath"
 	"syscall"
+	"time"
 )
 
 type Cmd struct {
 	cmd         *exec.Cmd
 	killSubProc bool
+	seccomp     []*SeccompProfile
+	outputLimit OutputLimit
+	noCapture   bool
+	stdout      io.Writer
+	stderr      io.Writer
+	onLine      func(Line)
+	stdoutFile  string
+	stderrFile  string
+	stdoutPipe  *os.File
+	pty         *PTY
+
+	stopSignal      os.Signal
+	stopGracePeriod time.Duration
 }
 
 // Command returns the Cmd struct to execute the named program with
@@ -88,6 +103,100 @@ func (c *Cmd) WithKillSubProcesses() *Cmd {
 	return c
 }
 
+// WithSeccomp installs the passed seccomp profiles
+// as syscall filters for the process.
+// A syscall is blocked if any of the profiles blocks it.
+// Seccomp filters are only supported on Linux,
+// Run returns an error on other platforms.
+func (c *Cmd) WithSeccomp(profiles ...*SeccompProfile) *Cmd {
+	c.seccomp = append(c.seccomp, profiles...)
+	return c
+}
+
+// WithStopSignal configures how the process is stopped
+// when the context passed to Run is canceled.
+// First sig is sent to the process, or its process group
+// if WithKillSubProcesses was used, and if the process
+// did not exit within gracePeriod it is killed with SIGKILL.
+// Without a stop signal the process is killed immediately.
+//
+// Run returns a *StoppedError with the StopStage
+// that ended the process.
+func (c *Cmd) WithStopSignal(sig os.Signal, gracePeriod time.Duration) *Cmd {
+	c.stopSignal = sig
+	c.stopGracePeriod = gracePeriod
+	return c
+}
+
+// WithOutputLimit limits the output captured in the Result
+// to the first limit.Head and last limit.Tail bytes
+// of stdout, stderr and the combined output.
+// Result.StdoutTruncated, Result.StderrTruncated and
+// Result.OutputTruncated tell if output was not captured.
+func (c *Cmd) WithOutputLimit(limit OutputLimit) *Cmd {
+	c.outputLimit = limit
+	return c
+}
+
+// WithStdout writes the stdout of the process to w
+// in addition to capturing it for the Result.
+// w is never called concurrently with the writer
+// passed to WithStderr, so the same writer can be used for both.
+func (c *Cmd) WithStdout(w io.Writer) *Cmd {
+	c.stdout = w
+	return c
+}
+
+// WithStderr writes the stderr of the process to w
+// in addition to capturing it for the Result.
+// w is never called concurrently with the writer
+// passed to WithStdout, so the same writer can be used for both.
+func (c *Cmd) WithStderr(w io.Writer) *Cmd {
+	c.stderr = w
+	return c
+}
+
+// WithLineCallback calls onLine for every line
+// written to stdout or stderr by the process.
+// Line.Seq records the order of the lines across both streams.
+// The callback is never called concurrently.
+func (c *Cmd) WithLineCallback(onLine func(Line)) *Cmd {
+	c.onLine = onLine
+	return c
+}
+
+// WithoutCapture disables capturing the output for the Result,
+// the output is only passed to the writers and the callback
+// set with WithStdout, WithStderr and WithLineCallback.
+// Result.StdoutBytes and Result.StderrBytes are still counted.
+func (c *Cmd) WithoutCapture() *Cmd {
+	c.noCapture = true
+	return c
+}
+
+// WithOutputFiles writes the complete stdout and stderr
+// of the process to the passed files independent
+// of the captured output in the Result.
+// Relative paths are relative to the working directory
+// of the command and empty paths are ignored.
+func (c *Cmd) WithOutputFiles(stdoutFile, stderrFile string) *Cmd {
+	c.stdoutFile = stdoutFile
+	c.stderrFile = stderrFile
+	return c
+}
+
+// WithPTY runs the command with a pseudo-terminal
+// as its controlling terminal, stdout and stderr,
+// and as stdin if no stdin was set with WithStdin.
+// The output is captured as a single stream in Result.Stdout
+// and Result.Output, Result.Stderr and the stderr output file stay empty.
+// Note that the terminal translates newlines to "\r\n".
+// Run returns ErrPTYNotSupported on platforms other than Linux.
+func (c *Cmd) WithPTY(pty PTY) *Cmd {
+	c.pty = &pty
+	return c
+}
+
 // String returns a string representation of the command
 // which might not exactly be identical to the real
 // command line that would be exected.
@@ -95,87 +204,145 @@ func (c *Cmd) String() string {
 	return c.cmd.String()
 }
 
+func (c *Cmd) outputFilePath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.cmd.Dir, name)
+}
+
 // Run the command and wait for the process to exit or the context to be canceled.
-// Non zero exit codes are not cosidered errors.
-// Context errors will be returned in wrapped form.
+// Non zero exit codes are not considered errors.
+// Context errors will be returned wrapped in a *StoppedError.
 func (c *Cmd) Run(ctx context.Context) (*Result, error) {
-	if ctx.Err() != nil {
-		return nil, ctx.Err()
+	p, err := c.Start(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return p.Wait()
+}
 
-	c.setSysProcAttr()
-
-	var (
-		stdout   strings.Builder
-		stderr   strings.Builder
-		combined strings.Builder
-	)
-	c.cmd.Stdout = io.MultiWriter(&stdout, &combined)
-	c.cmd.Stderr = io.MultiWriter(&stderr, &combined)
+// ptyDrainTimeout is how long to wait for the output
+// of a PTY after the process exited, because
+// background processes could keep the terminal open.
+const ptyDrainTimeout = time.Second
 
-	err := c.cmd.Start()
-	if err != nil {
-		return nil, err
+// waitPTYOutput waits until all output of a PTY is read
+// or closes the master after ptyDrainTimeout elapsed.
+// It does nothing if ptyOutput is nil.
+func waitPTYOutput(master *os.File, ptyOutput <-chan struct{}) {
+	if ptyOutput == nil {
+		return
+	}
+	timer := time.NewTimer(ptyDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-ptyOutput:
+	case <-timer.C:
+		master.Close()
+		<-ptyOutput
 	}
+}
 
-	done := make(chan error, 2)
-	dontKill := make(chan struct{}, 1)
+// stop stops the started process with the configured stop sequence
+// and waits until the process was reaped.
+// The process exited by itself after the stop signal
+// if StopStageSignal is returned.
+func (c *Cmd) stop(waitDone <-chan error) (StopStage, error) {
+	if c.stopSignal != nil && c.signal(c.stopSignal) == nil {
+		timer := time.NewTimer(c.stopGracePeriod)
+		defer timer.Stop()
 
-	go func() {
 		select {
-		case <-ctx.Done():
-			done <- c.kill()
-		case <-dontKill:
-			return
-		}
-	}()
-
-	go func() {
-		err := c.cmd.Wait()
-		var exitError *exec.ExitError
-		if errors.As(err, &exitError) {
-			// We are not interested in exit errors
-			// because they are just a wrapper for
-			// non zero exit status codes
-			// which we also get from c.cmd.ProcessState.
-			err = nil
+		case err := <-waitDone:
+			if err != nil {
+				return StopStageSignal, fmt.Errorf("error waiting for stopped process: %w", err)
+			}
+			return StopStageSignal, nil
+		case <-timer.C:
 		}
-		dontKill <- struct{}{}
-		done <- err
-	}()
-
-	// Wait for either finished command run or canceled context
-	err = <-done
-
-	switch {
-	case ctx.Err() != nil && err != nil:
-		return nil, fmt.Errorf("%s error killing process because of: %w", err, ctx.Err())
-	case ctx.Err() != nil:
-		return nil, fmt.Errorf("killed process because of: %w", ctx.Err())
-	case err != nil:
-		return nil, err
 	}
+	err := c.kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
+		// The process could still be running
+		return StopStageKill, fmt.Errorf("can't kill process: %w", err)
+	}
+	err = <-waitDone
+	if err != nil {
+		return StopStageKill, fmt.Errorf("error waiting for killed process: %w", err)
+	}
+	return StopStageKill, nil
+}
 
-	result := &Result{
+func (c *Cmd) result(start, end time.Time, capture *outputCapture) *Result {
+	r := &Result{
 		ExitCode:  c.cmd.ProcessState.ExitCode(),
 		ExitState: c.cmd.ProcessState.String(),
-		Output:    combined.String(),
-		Stdout:    stdout.String(),
-		Stderr:    stderr.String(),
-	}
+		Output:    capture.combined.String(),
+		Stdout:    capture.stdout.buf.String(),
+		Stderr:    capture.stderr.buf.String(),
+		Usage:     newUsage(start, end, c.cmd.ProcessState),
 
-	return result, nil
+		OutputTruncated: capture.combined.Truncated(),
+		StdoutTruncated: capture.stdout.buf.Truncated(),
+		StderrTruncated: capture.stderr.buf.Truncated(),
+		StdoutBytes:     capture.stdout.buf.total,
+		StderrBytes:     capture.stderr.buf.total,
+
+		KilledBySeccomp: c.killedBySeccomp(),
+	}
+	r.Signal, r.CoreDumped = termination(c.cmd.ProcessState)
+	switch {
+	case r.KilledBySeccomp != "":
+		r.StopReason = StopReasonSeccomp
+	case isResourceLimitSignal(r.Signal):
+		r.StopReason = StopReasonResourceLimit
+	}
+	return r
 }
 
 type Result struct {
+	// ExitCode is -1 if the process was terminated by a signal
 	ExitCode  int
 	ExitState string
 	Output    string
 	Stdout    string
 	Stderr    string
+	Usage     Usage
+
+	// OutputTruncated, StdoutTruncated and StderrTruncated
+	// tell if the captured output was truncated
+	// because of the limit set with Cmd.WithOutputLimit.
+	OutputTruncated bool
+	StdoutTruncated bool
+	StderrTruncated bool
+
+	// StdoutBytes and StderrBytes are the total number of bytes
+	// written by the process independent of truncation.
+	StdoutBytes int64
+	StderrBytes int64
+
+	// KilledBySeccomp holds the comma separated names
+	// of the seccomp profiles with SeccompActionKill
+	// if the process was terminated by SIGSYS.
+	// The attribution is ambiguous because the kernel does not
+	// report which filter blocked a syscall: all kill profiles
+	// of the command are listed, and a SIGSYS from another
+	// source would be attributed to them as well.
+	KilledBySeccomp string
+
+	// Signal is the name of the signal like "SIGSEGV"
+	// that terminated the process or empty
+	// if the process exited by itself.
+	Signal string
+	// CoreDumped tells if the terminated process dumped a core
+	CoreDumped bool
+	// StopReason tells why the process was stopped
+	// or empty if it was not stopped
+	StopReason StopReason
 }
 
-// CheckExitCode returns the ExitState as error if
+// CheckExitCode returns an *ExitError if
 // the ExitCode is not one of the passed validExitCodes
 // or non zero if no validExitCodes are passed.
 func (r *Result) CheckExitCode(validExitCodes ...int) error {
@@ -187,5 +354,17 @@ func (r *Result) CheckExitCode(validExitCodes ...int) error {
 			return nil
 		}
 	}
-	return errors.New(r.ExitState)
+	return r.ExitError()
+}
+
+// ExitError returns the termination details of the process as *ExitError
+// independent of the exit code.
+func (r *Result) ExitError() *ExitError {
+	return &ExitError{
+		ExitCode:   r.ExitCode,
+		ExitState:  r.ExitState,
+		Signal:     r.Signal,
+		CoreDumped: r.CoreDumped,
+		StopReason: r.StopReason,
+	}
 }
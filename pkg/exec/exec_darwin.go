@@ -1,6 +1,9 @@
 package exec
 
-import "syscall"
+import (
+	"os"
+	"syscall"
+)
 
 func (c *Cmd) setSysProcAttr() {
 	if c.killSubProc {
@@ -17,3 +20,19 @@ func (c *Cmd) kill() error {
 	}
 	return c.cmd.Process.Kill()
 }
+
+func (c *Cmd) signal(sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok && c.killSubProc {
+		return syscall.Kill(-c.cmd.Process.Pid, s) // minus sign is on purpose
+	}
+	return c.cmd.Process.Signal(sig)
+}
+
+func rusage(state *os.ProcessState) (maxRSS, inBlocks, outBlocks int64) {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, 0, 0
+	}
+	// ru_maxrss is in bytes on macOS
+	return int64(ru.Maxrss), int64(ru.Inblock), int64(ru.Oublock)
+}
@@ -1,6 +1,9 @@
 package exec
 
-import "syscall"
+import (
+	"os"
+	"syscall"
+)
 
 func (c *Cmd) setSysProcAttr() {
 	if c.killSubProc {
@@ -18,3 +21,19 @@ func (c *Cmd) kill() error {
 	}
 	return c.cmd.Process.Kill()
 }
+
+func (c *Cmd) signal(sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok && c.killSubProc {
+		return syscall.Kill(-c.cmd.Process.Pid, s) // minus sign is on purpose
+	}
+	return c.cmd.Process.Signal(sig)
+}
+
+func rusage(state *os.ProcessState) (maxRSS, inBlocks, outBlocks int64) {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, 0, 0
+	}
+	// ru_maxrss is in kilobytes on Linux
+	return int64(ru.Maxrss) * 1024, int64(ru.Inblock), int64(ru.Oublock)
+}
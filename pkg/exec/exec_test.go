@@ -0,0 +1,216 @@
+//go:build !windows
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cmd_WithStopSignal(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err := Command("sh", "-c", `trap 'echo flushed; exit 3' TERM; echo started; sleep 10 & wait`).
+			WithKillSubProcesses().
+			WithStopSignal(syscall.SIGTERM, 5*time.Second).
+			Run(ctx)
+
+		var stopped *StoppedError
+		require.ErrorAs(t, err, &stopped)
+		assert.Equal(t, StopStageSignal, stopped.Stage)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.NotNil(t, stopped.Result)
+		assert.Equal(t, "started\nflushed\n", stopped.Result.Stdout)
+		assert.Equal(t, 3, stopped.Result.ExitCode)
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := Command("sh", "-c", `trap '' TERM; sleep 10 & wait`).
+			WithKillSubProcesses().
+			WithStopSignal(syscall.SIGTERM, 200*time.Millisecond).
+			Run(ctx)
+
+		var stopped *StoppedError
+		require.ErrorAs(t, err, &stopped)
+		assert.Equal(t, StopStageKill, stopped.Stage)
+		assert.Nil(t, stopped.Result)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("no stop signal", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err := Command("sleep", "10").Run(ctx)
+
+		var stopped *StoppedError
+		require.ErrorAs(t, err, &stopped)
+		assert.Equal(t, StopStageKill, stopped.Stage)
+	})
+}
+
+func Test_Cmd_WithStdout(t *testing.T) {
+	var (
+		output strings.Builder
+		lines  []Line
+	)
+	result, err := Command("sh", "-c", `echo out1; sleep 0.1; echo err1 >&2; sleep 0.1; echo out2; sleep 0.1; printf err2 >&2`).
+		WithStdout(&output).
+		WithStderr(&output).
+		WithLineCallback(func(l Line) { lines = append(lines, l) }).
+		Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "out1\nerr1\nout2\nerr2", output.String())
+	assert.Equal(t, "out1\nout2\n", result.Stdout, "output is still captured")
+	assert.Equal(t, "err1\nerr2", result.Stderr, "output is still captured")
+	require.Len(t, lines, 4)
+	for i, expected := range []Line{
+		{Stream: StreamStdout, Seq: 0, Text: "out1"},
+		{Stream: StreamStderr, Seq: 1, Text: "err1"},
+		{Stream: StreamStdout, Seq: 2, Text: "out2"},
+		{Stream: StreamStderr, Seq: 3, Text: "err2"},
+	} {
+		assert.False(t, lines[i].Time.IsZero())
+		lines[i].Time = time.Time{}
+		assert.Equal(t, expected, lines[i])
+	}
+
+	result, err = Command("echo", "Hello World").
+		WithStdout(&output).
+		WithoutCapture().
+		Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "", result.Stdout, "output not captured")
+	assert.Equal(t, int64(len("Hello World\n")), result.StdoutBytes)
+}
+
+func Test_Pipeline(t *testing.T) {
+	result, err := NewPipeline(
+		Command("printf", `b\na\nc\n`),
+		Command("sort"),
+		Command("head", "-n", "2"),
+	).Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Stages, 3)
+	assert.Equal(t, "a\nb\n", result.Last().Stdout)
+	for _, stage := range result.Stages {
+		assert.Equal(t, 0, stage.ExitCode)
+	}
+
+	// yes is terminated by SIGPIPE after head exited
+	result, err = NewPipeline(Command("yes"), Command("head", "-n", "2")).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "y\ny\n", result.Last().Stdout)
+	assert.NotEqual(t, 0, result.Stages[0].ExitCode)
+
+	result, err = NewPipeline(Command("sh", "-c", "exit 3"), Command("cat")).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Stages[0].ExitCode)
+	assert.Equal(t, 0, result.Stages[1].ExitCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewPipeline(
+		Command("sleep", "10").WithKillSubProcesses(),
+		Command("sleep", "10").WithKillSubProcesses(),
+	).Run(ctx)
+	var stopped *StoppedError
+	assert.ErrorAs(t, err, &stopped)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	_, err = NewPipeline(Command("sleep", "10"), Command("rcom-command-does-not-exist")).Run(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second, "pipeline is stopped if a command fails")
+}
+
+func Test_Process(t *testing.T) {
+	lines := make(chan string, 10)
+	process, err := Command("sh", "-c", `trap 'echo usr1' USR1; trap 'echo term; exit 3' TERM; echo ready; while :; do :; done`).
+		WithKillSubProcesses().
+		WithLineCallback(func(l Line) { lines <- l.Text }).
+		Start(context.Background())
+	require.NoError(t, err)
+	assert.NotZero(t, process.PID())
+	assert.Equal(t, "ready", <-lines)
+
+	require.NoError(t, process.Signal(syscall.SIGUSR1))
+	assert.Equal(t, "usr1", <-lines)
+	select {
+	case <-process.Done():
+		t.Fatal("process should still be running")
+	default:
+	}
+
+	require.NoError(t, process.Signal(syscall.SIGTERM))
+	<-process.Done()
+	result, err := process.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "ready\nusr1\nterm\n", result.Stdout)
+	assert.ErrorIs(t, process.Signal(syscall.SIGUSR1), os.ErrProcessDone)
+}
+
+func Test_Process_Done_after_kill(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 1)
+	process, err := Command("sh", "-c", `trap '' TERM; echo ready; while :; do :; done`).
+		WithStopSignal(syscall.SIGTERM, 50*time.Millisecond).
+		WithLineCallback(func(l Line) { lines <- l.Text }).
+		Start(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ready", <-lines)
+
+	cancel()
+	<-process.Done()
+	assert.NotNil(t, process.cmd.cmd.ProcessState, "process was reaped before Done was closed")
+	_, err = process.Wait()
+	var stopped *StoppedError
+	require.ErrorAs(t, err, &stopped)
+	assert.Equal(t, StopStageKill, stopped.Stage)
+}
+
+func Test_Result_ExitError(t *testing.T) {
+	result, err := Command("sh", "-c", "exit 2").Run(context.Background())
+	require.NoError(t, err)
+	var exitErr *ExitError
+	require.ErrorAs(t, result.CheckExitCode(), &exitErr)
+	assert.Equal(t, &ExitError{ExitCode: 2, ExitState: "exit status 2"}, exitErr)
+	assert.NoError(t, result.CheckExitCode(2))
+
+	result, err = Command("sh", "-c", "kill -SEGV $$").Run(context.Background())
+	require.NoError(t, err)
+	require.ErrorAs(t, result.CheckExitCode(), &exitErr)
+	assert.Equal(t, -1, exitErr.ExitCode)
+	assert.Equal(t, "SIGSEGV", exitErr.Signal)
+	assert.Equal(t, StopReason(""), exitErr.StopReason)
+
+	result, err = Command("sh", "-c", "ulimit -S -t 1; while :; do :; done").Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "SIGXCPU", result.Signal)
+	assert.Equal(t, StopReasonResourceLimit, result.StopReason)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = Command("sleep", "10").WithStopSignal(syscall.SIGTERM, time.Second).Run(ctx)
+	var stopped *StoppedError
+	require.ErrorAs(t, err, &stopped)
+	assert.Equal(t, StopReasonDeadline, stopped.Reason)
+	assert.Equal(t, "SIGTERM", stopped.Result.Signal)
+	assert.Equal(t, StopReasonDeadline, stopped.Result.StopReason)
+}
@@ -1,5 +1,7 @@
 package exec
 
+import "os"
+
 func (c *Cmd) setSysProcAttr() {
 	// Nop for Windows
 }
@@ -7,3 +9,13 @@ func (c *Cmd) setSysProcAttr() {
 func (c *Cmd) kill() error {
 	return c.cmd.Process.Kill()
 }
+
+func (c *Cmd) signal(sig os.Signal) error {
+	// Only os.Kill is supported on Windows
+	return c.cmd.Process.Signal(sig)
+}
+
+func rusage(state *os.ProcessState) (maxRSS, inBlocks, outBlocks int64) {
+	// Not available on Windows
+	return 0, 0, 0
+}
@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// StopReason tells why a process was stopped
+// or killed before it could exit by itself.
+type StopReason string
+
+const (
+	// StopReasonDeadline means that the deadline
+	// of the context passed to Run or Start was exceeded
+	StopReasonDeadline StopReason = "deadline"
+
+	// StopReasonCanceled means that the context
+	// passed to Run or Start was canceled
+	StopReasonCanceled StopReason = "canceled"
+
+	// StopReasonResourceLimit means that the process was
+	// terminated because it exceeded a CPU time or file size limit
+	StopReasonResourceLimit StopReason = "resource-limit"
+
+	// StopReasonSeccomp means that the process was killed
+	// by a seccomp profile because of a blocked syscall
+	StopReasonSeccomp StopReason = "seccomp"
+)
+
+func contextStopReason(ctx context.Context) StopReason {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return StopReasonDeadline
+	}
+	return StopReasonCanceled
+}
+
+// ExitError is returned by Result.CheckExitCode
+// with the details about the termination of a process
+// that did not exit with a valid exit code.
+type ExitError struct {
+	// ExitCode is -1 if the process was terminated by a signal
+	ExitCode int `json:"exitCode"`
+	// ExitState is the exit status as human readable string
+	ExitState string `json:"exitState"`
+	// Signal is the name of the signal like "SIGSEGV"
+	// that terminated the process or empty
+	Signal string `json:"signal,omitempty"`
+	// CoreDumped tells if the terminated process dumped a core
+	CoreDumped bool `json:"coreDumped,omitempty"`
+	// StopReason tells why the process was stopped or empty
+	StopReason StopReason `json:"stopReason,omitempty"`
+}
+
+func (e *ExitError) Error() string {
+	if e.StopReason != "" {
+		return fmt.Sprintf("%s (%s)", e.ExitState, e.StopReason)
+	}
+	return e.ExitState
+}
+
+// termination returns the terminating signal name
+// and if a core was dumped from the process state.
+func termination(state *os.ProcessState) (signal string, coreDumped bool) {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", false
+	}
+	return signalName(ws.Signal()), ws.CoreDump()
+}
@@ -0,0 +1,148 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Pipeline connects the stdout of every command
+// to the stdin of the next command like a shell pipeline,
+// but without using a shell.
+type Pipeline struct {
+	cmds []*Cmd
+}
+
+// NewPipeline returns a Pipeline of the passed commands.
+//
+// The stdin of the first command can be set with Cmd.WithStdin,
+// the stdin of the other commands and the stdout of all commands
+// except the last one are connected by pipes and can't be set.
+// Output writers, line callbacks and output files only receive
+// the stdout of the last command.
+func NewPipeline(cmds ...*Cmd) *Pipeline {
+	return &Pipeline{cmds: cmds}
+}
+
+// String returns a string representation of the pipeline
+// with the commands separated by " | ".
+func (p *Pipeline) String() string {
+	s := make([]string, len(p.cmds))
+	for i, cmd := range p.cmds {
+		s[i] = cmd.String()
+	}
+	return strings.Join(s, " | ")
+}
+
+// PipelineResult holds the results of all commands of a Pipeline.
+type PipelineResult struct {
+	// Stages holds the results of the commands in pipeline order.
+	// The Stdout of all but the last command is empty
+	// because it was piped to the next command.
+	Stages []*Result
+}
+
+// Last returns the result of the last command of the pipeline.
+func (r *PipelineResult) Last() *Result {
+	return r.Stages[len(r.Stages)-1]
+}
+
+// Usage returns the combined usage of all commands.
+// Start and End span all commands, CPU times and
+// block operations are summed up and MaxRSS is the maximum.
+func (r *PipelineResult) Usage() Usage {
+	var u Usage
+	for i, stage := range r.Stages {
+		s := stage.Usage
+		if i == 0 || s.Start.Before(u.Start) {
+			u.Start = s.Start
+		}
+		if s.End.After(u.End) {
+			u.End = s.End
+		}
+		u.UserTime += s.UserTime
+		u.SystemTime += s.SystemTime
+		u.MaxRSS = max(u.MaxRSS, s.MaxRSS)
+		u.InBlocks += s.InBlocks
+		u.OutBlocks += s.OutBlocks
+	}
+	u.WallTime = u.End.Sub(u.Start)
+	return u
+}
+
+// Run starts all commands of the pipeline and waits
+// until all have exited or the context is canceled.
+// All commands are stopped if the context is canceled
+// or if one of them returns an error.
+// Non zero exit codes are not considered errors.
+func (p *Pipeline) Run(ctx context.Context) (*PipelineResult, error) {
+	if len(p.cmds) == 0 {
+		return nil, errors.New("empty pipeline")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The parent process ends of the pipes are closed
+	// after the connected commands exited
+	// so that the next command reads EOF
+	// and the previous command gets EPIPE
+	// if the next command exited early.
+	stdins := make([]*os.File, len(p.cmds))
+	stdouts := make([]*os.File, len(p.cmds))
+	for i := 1; i < len(p.cmds); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, f := range append(stdins, stdouts...) {
+				if f != nil {
+					f.Close()
+				}
+			}
+			return nil, err
+		}
+		stdins[i], stdouts[i-1] = r, w
+		p.cmds[i].cmd.Stdin = r
+		p.cmds[i-1].stdoutPipe = w
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]*Result, len(p.cmds))
+		errs    = make([]error, len(p.cmds))
+	)
+	for i, cmd := range p.cmds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = cmd.Run(ctx)
+			if stdins[i] != nil {
+				stdins[i].Close()
+			}
+			if stdouts[i] != nil {
+				stdouts[i].Close()
+			}
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Return the error of the first failed command,
+	// other commands will have been stopped because of it
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("pipeline command %d %s: %w", i+1, p.cmds[i], err)
+		}
+	}
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("pipeline command %d %s: %w", i+1, p.cmds[i], err)
+		}
+	}
+	return &PipelineResult{Stages: results}, nil
+}
@@ -0,0 +1,232 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Process is a started command returned by Cmd.Start.
+// All methods are safe for concurrent use.
+type Process struct {
+	cmd     *Cmd
+	capture *outputCapture
+	started time.Time
+
+	// Closed after the process exited
+	// and all resources of the Process are released
+	done   chan struct{}
+	result *Result
+	err    error
+
+	// Called in reverse order after the process exited
+	cleanups []func()
+}
+
+// Start starts the command without waiting for it to exit.
+// The process is stopped with the configured stop sequence
+// or killed if the context is canceled before it exits.
+// Use Process.Wait to get the Result.
+func (c *Cmd) Start(ctx context.Context) (*Process, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	p := &Process{
+		cmd:  c,
+		done: make(chan struct{}),
+	}
+	master, ptyOutput, err := p.start()
+	if err != nil {
+		p.cleanup()
+		return nil, err
+	}
+	go p.wait(ctx, master, ptyOutput)
+	return p, nil
+}
+
+// start sets up the output and starts the process.
+// The returned master and ptyOutput are non nil in PTY mode.
+func (p *Process) start() (master *os.File, ptyOutput chan struct{}, err error) {
+	c := p.cmd
+	c.setSysProcAttr()
+
+	p.capture = c.newOutputCapture()
+	c.cmd.Stdout = p.capture.Stdout()
+	c.cmd.Stderr = p.capture.Stderr()
+	if c.stdoutPipe != nil {
+		// Connected directly to the next command of a Pipeline
+		c.cmd.Stdout = c.stdoutPipe
+	} else if c.stdoutFile != "" {
+		file, err := os.Create(c.outputFilePath(c.stdoutFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		p.onCleanup(func() { file.Close() })
+		c.cmd.Stdout = io.MultiWriter(c.cmd.Stdout, file)
+	}
+	if c.stderrFile != "" {
+		file, err := os.Create(c.outputFilePath(c.stderrFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		p.onCleanup(func() { file.Close() })
+		c.cmd.Stderr = io.MultiWriter(c.cmd.Stderr, file)
+	}
+
+	var tty *os.File
+	if c.pty != nil {
+		if c.stdoutPipe != nil {
+			return nil, nil, errors.New("a command with PTY can't write to a pipe")
+		}
+		master, tty, err = c.openPTY()
+		if err != nil {
+			return nil, nil, err
+		}
+		// Closing twice after a successful start is harmless
+		p.onCleanup(func() { tty.Close() })
+
+		output := c.cmd.Stdout
+		if c.pty.StripANSI {
+			output = newANSIStripper(output)
+		}
+		ptyOutput = make(chan struct{})
+		go func() {
+			defer close(ptyOutput)
+			// Returns with EIO when the terminal is closed
+			_, _ = io.Copy(output, master)
+		}()
+		p.onCleanup(func() {
+			master.Close()
+			<-ptyOutput
+		})
+
+		if c.cmd.Stdin == nil {
+			c.cmd.Stdin = tty
+		}
+		c.cmd.Stdout = tty
+		c.cmd.Stderr = tty
+	}
+
+	release := make(chan struct{})
+	p.onCleanup(func() { close(release) })
+
+	p.started = time.Now()
+	if len(c.seccomp) > 0 {
+		err = c.startWithSeccomp(release)
+	} else {
+		err = c.cmd.Start()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if tty != nil {
+		// The terminal has to be closed in the parent process
+		// so that reading the master returns an error
+		// once the process and its children closed it
+		tty.Close()
+	}
+	return master, ptyOutput, nil
+}
+
+// wait waits for either the exit of the process
+// or the canceled context and sets the result.
+func (p *Process) wait(ctx context.Context, master *os.File, ptyOutput <-chan struct{}) {
+	defer close(p.done)
+	defer p.cleanup()
+
+	c := p.cmd
+	var end time.Time
+	waitDone := make(chan error, 1)
+	go func() {
+		err := c.cmd.Wait()
+		end = time.Now()
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			// We are not interested in exit errors
+			// because they are just a wrapper for
+			// non zero exit status codes
+			// which we also get from c.cmd.ProcessState.
+			err = nil
+		}
+		waitDone <- err
+	}()
+
+	select {
+	case err := <-waitDone:
+		if err != nil {
+			p.err = err
+			return
+		}
+		waitPTYOutput(master, ptyOutput)
+		p.capture.flushLines()
+		p.result = c.result(p.started, end, p.capture)
+
+	case <-ctx.Done():
+		reason := contextStopReason(ctx)
+		stage, err := c.stop(waitDone)
+		switch {
+		case err != nil:
+			p.err = fmt.Errorf("%w, stopped because of: %w", err, ctx.Err())
+		case stage == StopStageSignal:
+			waitPTYOutput(master, ptyOutput)
+			p.capture.flushLines()
+			result := c.result(p.started, end, p.capture)
+			result.StopReason = reason
+			p.err = &StoppedError{
+				Stage:  stage,
+				Reason: reason,
+				Result: result,
+				Err:    ctx.Err(),
+			}
+		default:
+			p.err = &StoppedError{Stage: stage, Reason: reason, Err: ctx.Err()}
+		}
+	}
+}
+
+func (p *Process) onCleanup(f func()) {
+	p.cleanups = append(p.cleanups, f)
+}
+
+func (p *Process) cleanup() {
+	for i := len(p.cleanups) - 1; i >= 0; i-- {
+		p.cleanups[i]()
+	}
+}
+
+// PID returns the process ID
+func (p *Process) PID() int {
+	return p.cmd.cmd.Process.Pid
+}
+
+// Signal sends a signal to the process
+// and all its sub-processes if the command
+// was configured with WithKillSubProcesses.
+// It returns os.ErrProcessDone if the process already exited.
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	default:
+		return p.cmd.signal(sig)
+	}
+}
+
+// Done returns a channel that is closed
+// when the process exited and Wait will not block.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit or the context
+// passed to Cmd.Start to be canceled and returns
+// the same result and error as Cmd.Run.
+// Wait can be called multiple times.
+func (p *Process) Wait() (*Result, error) {
+	<-p.done
+	return p.result, p.err
+}
@@ -0,0 +1,110 @@
+package exec
+
+import (
+	"errors"
+	"io"
+)
+
+// PTY configures the pseudo-terminal
+// of a command run with Cmd.WithPTY.
+type PTY struct {
+	// Rows and Cols are the size of the terminal window.
+	// Zero values default to 24 rows and 80 columns.
+	Rows uint16 `json:"rows,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	// StripANSI removes ANSI escape sequences
+	// like colors and cursor movements from the output.
+	StripANSI bool `json:"stripANSI,omitempty"`
+}
+
+func (p PTY) size() (rows, cols uint16) {
+	rows, cols = p.Rows, p.Cols
+	if rows == 0 {
+		rows = 24
+	}
+	if cols == 0 {
+		cols = 80
+	}
+	return rows, cols
+}
+
+// ErrPTYNotSupported is returned when running a command
+// with a pseudo-terminal on a platform other than Linux.
+var ErrPTYNotSupported = errors.New("PTY mode is only supported on Linux")
+
+// ansiStripper is a writer that removes ANSI escape sequences
+// from the written bytes before passing them on.
+// It keeps its state between writes so that
+// sequences can be split across writes.
+type ansiStripper struct {
+	w     io.Writer
+	state ansiState
+	buf   []byte
+}
+
+type ansiState int
+
+const (
+	ansiText      ansiState = iota
+	ansiEsc                 // after ESC
+	ansiEscInter            // after ESC and intermediate bytes
+	ansiCSI                 // control sequence: ESC [ ... final byte
+	ansiString              // OSC, DCS, SOS, PM or APC string terminated by BEL or ST
+	ansiStringEsc           // ESC within a string, ESC \ is the string terminator
+)
+
+func newANSIStripper(w io.Writer) *ansiStripper {
+	return &ansiStripper{w: w}
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	s.buf = s.buf[:0]
+	for _, b := range p {
+		switch s.state {
+		case ansiText:
+			if b == 0x1b {
+				s.state = ansiEsc
+			} else {
+				s.buf = append(s.buf, b)
+			}
+		case ansiEsc:
+			switch {
+			case b == '[':
+				s.state = ansiCSI
+			case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+				s.state = ansiString
+			case b >= 0x20 && b <= 0x2f:
+				s.state = ansiEscInter
+			default:
+				s.state = ansiText
+			}
+		case ansiEscInter:
+			if b < 0x20 || b > 0x2f {
+				s.state = ansiText
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = ansiText
+			}
+		case ansiString:
+			switch b {
+			case 0x07:
+				s.state = ansiText
+			case 0x1b:
+				s.state = ansiStringEsc
+			}
+		case ansiStringEsc:
+			if b == '\\' {
+				s.state = ansiText
+			} else {
+				s.state = ansiString
+			}
+		}
+	}
+	if len(s.buf) > 0 {
+		if _, err := s.w.Write(s.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,70 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a new pseudo-terminal pair
+// and configures the command to use the terminal
+// as its controlling terminal in a new session.
+func (c *Cmd) openPTY() (master, tty *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		unlock int32
+		n      uint32
+	)
+	err = ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+	if err == nil {
+		err = ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err == nil {
+		tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("can't open PTY: %w", err)
+	}
+
+	rows, cols := c.pty.size()
+	size := struct{ Row, Col, X, Y uint16 }{Row: rows, Col: cols}
+	err = ioctl(tty, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+	if err != nil {
+		master.Close()
+		tty.Close()
+		return nil, nil, fmt.Errorf("can't set PTY window size: %w", err)
+	}
+
+	if c.cmd.SysProcAttr == nil {
+		c.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.cmd.SysProcAttr.Setsid = true
+	c.cmd.SysProcAttr.Setctty = true
+	c.cmd.SysProcAttr.Ctty = 1 // stdout of the child
+	return master, tty, nil
+}
+
+// ioctl uses SyscallConn instead of File.Fd
+// to keep the file in non-blocking mode.
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package exec
+
+import "os"
+
+func (c *Cmd) openPTY() (master, tty *os.File, err error) {
+	return nil, nil, ErrPTYNotSupported
+}
@@ -0,0 +1,66 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ansiStripper(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "plain", writes: []string{"Hello\r\nWorld"}, want: "Hello\r\nWorld"},
+		{name: "colors", writes: []string{"\x1b[1;31mred\x1b[0m text"}, want: "red text"},
+		{name: "cursor", writes: []string{"a\x1b[2Kb\x1b[10;20Hc\x1b[?25ld"}, want: "abcd"},
+		{name: "split CSI", writes: []string{"a\x1b", "[3", "1mb"}, want: "ab"},
+		{name: "OSC BEL", writes: []string{"\x1b]0;title\x07text"}, want: "text"},
+		{name: "OSC ST", writes: []string{"\x1b]8;;http://x\x1b", "\\link"}, want: "link"},
+		{name: "charset", writes: []string{"\x1b(Btext\x1b="}, want: "text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			s := newANSIStripper(&b)
+			for _, w := range tt.writes {
+				n, err := s.Write([]byte(w))
+				require.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
+
+func Test_Cmd_WithPTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		_, err := Command("echo").WithPTY(PTY{}).Run(context.Background())
+		assert.ErrorIs(t, err, ErrPTYNotSupported)
+		return
+	}
+	if _, err := os.Stat("/dev/ptmx"); errors.Is(err, os.ErrNotExist) {
+		t.Skip("no /dev/ptmx")
+	}
+
+	result, err := Command("sh", "-c", `test -t 0 && test -t 1 && echo tty; stty size; printf '\033[1mbold\033[0m\n' >&2`).
+		WithPTY(PTY{Rows: 30, Cols: 100}).
+		Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "tty\r\n30 100\r\n\x1b[1mbold\x1b[0m\r\n", result.Stdout)
+	assert.Equal(t, result.Stdout, result.Output)
+	assert.Equal(t, "", result.Stderr)
+
+	result, err = Command("sh", "-c", `printf '\033[1mbold\033[0m\n'`).
+		WithPTY(PTY{StripANSI: true}).
+		Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "bold\r\n", result.Stdout)
+}
@@ -0,0 +1,124 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// SeccompAction defines what happens when a process
+// calls a syscall that is blocked by a SeccompProfile.
+type SeccompAction string
+
+const (
+	// SeccompActionErrno makes blocked syscalls fail with EPERM
+	SeccompActionErrno SeccompAction = "errno"
+
+	// SeccompActionKill kills the process with SIGSYS
+	// when it calls a blocked syscall
+	SeccompActionKill SeccompAction = "kill"
+)
+
+// SeccompProfile is a named seccomp-bpf syscall filter
+// that gets installed for a started process.
+// Either Allow or Deny must be set, but not both.
+//
+// Seccomp filters are only supported on Linux.
+type SeccompProfile struct {
+	Name string `json:"name"`
+
+	// Allow lists the only syscalls the process may call.
+	// The syscalls needed to start the process are always allowed,
+	// see SeccompStartSyscalls.
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists the syscalls the process must not call.
+	Deny []string `json:"deny,omitempty"`
+
+	// Action for blocked syscalls,
+	// SeccompActionErrno is used if empty.
+	Action SeccompAction `json:"action,omitempty"`
+}
+
+// Built-in seccomp profiles
+var (
+	// SeccompNoNetwork blocks creating and using sockets
+	SeccompNoNetwork = &SeccompProfile{
+		Name: "no-network",
+		Deny: []string{"socket", "connect", "bind", "listen", "accept", "accept4"},
+	}
+
+	// SeccompNoPtrace blocks tracing and accessing the memory of other processes
+	SeccompNoPtrace = &SeccompProfile{
+		Name: "no-ptrace",
+		Deny: []string{"ptrace", "process_vm_readv", "process_vm_writev"},
+	}
+
+	// SeccompNoMount blocks changing mounts
+	SeccompNoMount = &SeccompProfile{
+		Name: "no-mount",
+		Deny: []string{
+			"mount",
+			"umount2",
+			"pivot_root",
+			"open_tree",
+			"move_mount",
+			"fsopen",
+			"fsconfig",
+			"fsmount",
+			"fspick",
+			"mount_setattr",
+		},
+	}
+)
+
+// BuiltinSeccompProfile returns the built-in profile
+// with the passed name or nil if there is none.
+func BuiltinSeccompProfile(name string) *SeccompProfile {
+	for _, p := range []*SeccompProfile{SeccompNoNetwork, SeccompNoPtrace, SeccompNoMount} {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// SeccompStartSyscalls are always allowed by profiles with an Allow list
+// because they are needed to start a process.
+// Names that are not available on the current architecture are ignored.
+var SeccompStartSyscalls = []string{
+	// Go runtime and os/exec between installing the filter and exec
+	"clone", "clone3", "execve", "execveat", "exit", "exit_group",
+	"read", "write", "close", "close_range", "pipe2", "openat", "fcntl",
+	"dup2", "dup3", "ioctl", "chdir", "setsid", "setpgid", "prctl",
+	"getpid", "getppid", "gettid", "tgkill", "wait4", "waitid",
+	"futex", "nanosleep", "sched_yield", "mmap", "munmap", "mprotect", "madvise",
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sigaltstack",
+	"epoll_ctl", "pidfd_open", "pidfd_send_signal",
+	// Dynamic loader of the started process
+	"brk", "arch_prctl", "access", "faccessat", "faccessat2", "newfstatat", "fstat",
+	"pread64", "set_tid_address", "set_robust_list", "rseq", "prlimit64", "getrandom",
+}
+
+// Validate returns an error if the profile is not usable.
+func (p *SeccompProfile) Validate() error {
+	if p.Name == "" {
+		return errors.New("seccomp profile has no name")
+	}
+	if (len(p.Allow) == 0) == (len(p.Deny) == 0) {
+		return fmt.Errorf("seccomp profile %q must have either an allow or a deny list", p.Name)
+	}
+	switch p.Action {
+	case "", SeccompActionErrno, SeccompActionKill:
+	default:
+		return fmt.Errorf("seccomp profile %q has invalid action %q", p.Name, p.Action)
+	}
+	return checkSeccompSyscalls(slices.Concat(p.Allow, p.Deny))
+}
+
+func (p *SeccompProfile) action() SeccompAction {
+	if p.Action == "" {
+		return SeccompActionErrno
+	}
+	return p.Action
+}
@@ -0,0 +1,161 @@
+//go:build linux && (amd64 || arm64)
+
+package exec
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// See linux/seccomp.h, linux/filter.h and linux/prctl.h
+const (
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// Offsets in struct seccomp_data
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	bpfLdWAbs = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+)
+
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+func checkSeccompSyscalls(names []string) error {
+	for _, name := range names {
+		if _, ok := seccompSyscalls[name]; !ok {
+			return fmt.Errorf("unknown syscall %q for %s", name, runtime.GOARCH)
+		}
+	}
+	return nil
+}
+
+func seccompProgram(p *SeccompProfile) ([]sockFilter, error) {
+	err := p.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var blocked uint32 = seccompRetErrno | uint32(syscall.EPERM)
+	if p.action() == SeccompActionKill {
+		blocked = seccompRetKillProcess
+	}
+	listed, other := blocked, uint32(seccompRetAllow)
+	names := p.Deny
+	if len(p.Allow) > 0 {
+		listed, other = seccompRetAllow, blocked
+		names = append(p.Allow[:len(p.Allow):len(p.Allow)], SeccompStartSyscalls...)
+	}
+
+	prog := []sockFilter{
+		// Kill processes calling syscalls of another architecture
+		{code: bpfLdWAbs, k: seccompDataArch},
+		{code: bpfJeqK, jt: 1, k: seccompAuditArch},
+		{code: bpfRetK, k: seccompRetKillProcess},
+		{code: bpfLdWAbs, k: seccompDataNr},
+	}
+	if seccompX32SyscallBit != 0 {
+		// Block the x32 ABI that shares the x86_64 audit arch
+		prog = append(prog,
+			sockFilter{code: bpfJgeK, jf: 1, k: seccompX32SyscallBit},
+			sockFilter{code: bpfRetK, k: blocked},
+		)
+	}
+	added := make(map[uint32]bool)
+	for _, name := range names {
+		nr, ok := seccompSyscalls[name]
+		if !ok || added[nr] {
+			// Unknown names can only come from SeccompStartSyscalls
+			// because Validate checked the profile's names
+			continue
+		}
+		added[nr] = true
+		prog = append(prog,
+			sockFilter{code: bpfJeqK, jf: 1, k: nr},
+			sockFilter{code: bpfRetK, k: listed},
+		)
+	}
+	return append(prog, sockFilter{code: bpfRetK, k: other}), nil
+}
+
+// startWithSeccomp starts the command from a new OS thread
+// that has the seccomp filters installed,
+// so that the started process inherits them.
+// The thread is kept alive until release is closed
+// because its exit would trigger the Pdeathsig of the process.
+func (c *Cmd) startWithSeccomp(release <-chan struct{}) error {
+	progs := make([][]sockFilter, len(c.seccomp))
+	for i, p := range c.seccomp {
+		prog, err := seccompProgram(p)
+		if err != nil {
+			return err
+		}
+		progs[i] = prog
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked so the Go runtime
+		// terminates it together with its filters
+		// when this goroutine exits.
+		runtime.LockOSThread()
+
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+		if errno != 0 {
+			errc <- fmt.Errorf("can't set no_new_privs: %w", errno)
+			return
+		}
+		for i, prog := range progs {
+			fprog := sockFprog{len: uint16(len(prog)), filter: &prog[0]}
+			_, _, errno = syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog)))
+			if errno != 0 {
+				errc <- fmt.Errorf("can't install seccomp profile %q: %w", c.seccomp[i].Name, errno)
+				return
+			}
+		}
+		errc <- c.cmd.Start()
+		<-release
+	}()
+	return <-errc
+}
+
+// killedBySeccomp returns the comma separated names
+// of the profiles that kill a process on a blocked syscall
+// if the process was terminated by SIGSYS.
+// The kernel does not report which filter blocked the syscall,
+// so with multiple kill profiles all of them are returned
+// and a SIGSYS sent by another process is attributed to them too.
+func (c *Cmd) killedBySeccomp() string {
+	status, ok := c.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGSYS {
+		return ""
+	}
+	var names []string
+	for _, p := range c.seccomp {
+		if p.action() == SeccompActionKill {
+			names = append(names, p.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,108 @@
+//go:build linux && (amd64 || arm64)
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seccompHelperEnv makes the test binary act as
+// child process that calls a syscall in Test_seccompHelper
+const seccompHelperEnv = "RCOM_SECCOMP_HELPER"
+
+// seccompHelper returns a command that runs the test binary
+// as helper process which creates a socket
+// and prints the resulting errno.
+func seccompHelper() *Cmd {
+	return Command(os.Args[0], "-test.run=^Test_seccompHelper$").
+		WithEnv(append(os.Environ(), seccompHelperEnv+"=socket"))
+}
+
+func Test_seccompHelper(t *testing.T) {
+	if os.Getenv(seccompHelperEnv) != "socket" {
+		t.Skip("only executed as helper process")
+	}
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		fmt.Print(err.(syscall.Errno).Error())
+		os.Exit(1)
+	}
+	syscall.Close(fd)
+	fmt.Print("ok")
+	os.Exit(0)
+}
+
+func Test_Cmd_WithSeccomp(t *testing.T) {
+	t.Run("no profile", func(t *testing.T) {
+		result, err := seccompHelper().Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "ok", result.Stdout)
+	})
+
+	t.Run("errno", func(t *testing.T) {
+		result, err := seccompHelper().WithSeccomp(SeccompNoNetwork).Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.ExitCode)
+		assert.Equal(t, syscall.EPERM.Error(), result.Stdout)
+		assert.Empty(t, result.KilledBySeccomp)
+		assert.Empty(t, result.StopReason)
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		killNetwork := &SeccompProfile{Name: "kill-network", Deny: []string{"socket"}, Action: SeccompActionKill}
+		result, err := seccompHelper().WithSeccomp(SeccompNoPtrace, killNetwork).Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, -1, result.ExitCode)
+		assert.Equal(t, "SIGSYS", result.Signal)
+		assert.Equal(t, "kill-network", result.KilledBySeccomp, "errno profiles can't kill")
+		assert.Equal(t, StopReasonSeccomp, result.StopReason)
+	})
+
+	t.Run("allow list", func(t *testing.T) {
+		onlyExit := &SeccompProfile{Name: "only-exit", Allow: []string{"exit_group"}, Action: SeccompActionKill}
+		result, err := Command("uname").WithSeccomp(onlyExit).Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "SIGSYS", result.Signal, "uname syscall is not allowed")
+		assert.Equal(t, "only-exit", result.KilledBySeccomp)
+
+		// The Go runtime keeps using the thread that installed
+		// the filters until the process was started,
+		// a syscall it needs that is not allowed
+		// would kill the test process itself.
+		defer func(syscalls []string) { SeccompStartSyscalls = syscalls }(SeccompStartSyscalls)
+		SeccompStartSyscalls = slices.Concat(SeccompStartSyscalls, []string{"uname"})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for range cap(errs) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Let the garbage collector stop and preempt
+				// goroutines while the filtered threads exist
+				runtime.GC()
+				result, err := Command("uname").WithSeccomp(onlyExit).Run(context.Background())
+				if err == nil && result.ExitCode != 0 {
+					err = errors.New(result.ExitState)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+	})
+}
@@ -0,0 +1,20 @@
+//go:build !linux || !(amd64 || arm64)
+
+package exec
+
+import (
+	"errors"
+	"runtime"
+)
+
+func checkSeccompSyscalls(names []string) error {
+	return nil
+}
+
+func (c *Cmd) startWithSeccomp(release <-chan struct{}) error {
+	return errors.New("seccomp filters are not supported on " + runtime.GOOS + "/" + runtime.GOARCH)
+}
+
+func (c *Cmd) killedBySeccomp() string {
+	return ""
+}
@@ -0,0 +1,15 @@
+package exec
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Processes are never terminated by signals on Windows
+func signalName(sig syscall.Signal) string {
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+func isResourceLimitSignal(name string) bool {
+	return false
+}
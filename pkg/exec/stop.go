@@ -0,0 +1,42 @@
+package exec
+
+import "fmt"
+
+// StopStage is the stage of the stop sequence
+// that ended a process after its context was canceled.
+type StopStage string
+
+const (
+	// StopStageSignal means that the process exited
+	// within the grace period after the stop signal
+	StopStageSignal StopStage = "signal"
+
+	// StopStageKill means that the process was killed with SIGKILL
+	StopStageKill StopStage = "kill"
+)
+
+// StoppedError is returned by Cmd.Run
+// when the process was stopped because
+// the context was canceled.
+type StoppedError struct {
+	// Stage that ended the process
+	Stage StopStage
+	// Reason is StopReasonDeadline or StopReasonCanceled
+	Reason StopReason
+	// Result holds the partial output of the process
+	// if it exited after the stop signal, else it is nil
+	Result *Result
+	// Err is the error of the canceled context
+	Err error
+}
+
+func (e *StoppedError) Error() string {
+	if e.Stage == StopStageSignal {
+		return fmt.Sprintf("stopped process with signal because of: %s", e.Err)
+	}
+	return fmt.Sprintf("killed process because of: %s", e.Err)
+}
+
+func (e *StoppedError) Unwrap() error {
+	return e.Err
+}
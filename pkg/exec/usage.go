@@ -0,0 +1,39 @@
+package exec
+
+import (
+	"os"
+	"time"
+)
+
+// Usage holds the timing and resource usage of an exited process.
+// Resource usage that is not available on a platform is zero.
+type Usage struct {
+	// Start is the time when the process was started
+	Start time.Time
+	// End is the time when the process exited
+	End time.Time
+	// WallTime is the duration between Start and End
+	WallTime time.Duration
+	// UserTime is the user CPU time of the process and its waited for children
+	UserTime time.Duration
+	// SystemTime is the system CPU time of the process and its waited for children
+	SystemTime time.Duration
+	// MaxRSS is the maximum resident set size in bytes
+	MaxRSS int64
+	// InBlocks is the number of block input operations
+	InBlocks int64
+	// OutBlocks is the number of block output operations
+	OutBlocks int64
+}
+
+func newUsage(start, end time.Time, state *os.ProcessState) Usage {
+	u := Usage{
+		Start:      start,
+		End:        end,
+		WallTime:   end.Sub(start),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+	u.MaxRSS, u.InBlocks, u.OutBlocks = rusage(state)
+	return u
+}
@@ -0,0 +1,350 @@
+package rcom
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/ungerik/go-fs"
+)
+
+// Policy configures which commands a server executes and how.
+// It is usually loaded from a JSON file with LoadPolicyFile.
+type Policy struct {
+	// Commands maps the names of the allowed commands
+	// to their optional command specific policy.
+	Commands map[string]*CommandPolicy `json:"commands"`
+
+	// MaxConcurrent limits the number of commands
+	// a server executes in parallel if greater zero.
+	// Further requests wait in a queue.
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+
+	// OutputLimit limits the captured outputs of commands.
+	// DefaultOutputLimit is used if nil,
+	// a zero OutputLimit does not limit the outputs.
+	OutputLimit *exec.OutputLimit `json:"outputLimit,omitempty"`
+
+	// Stop configures how commands are stopped when
+	// their request is canceled or the server shuts down.
+	// Commands are killed immediately if nil.
+	Stop *StopPolicy `json:"stop,omitempty"`
+
+	// Env lists the names of the environment variables
+	// that all commands may set via Command.Env.
+	// A name ending with "*" allows all variables with that prefix.
+	Env []string `json:"env,omitempty"`
+
+	// Secrets are the sources of secrets by name
+	// that commands can reference via Command.Secrets
+	// if the name is listed in CommandPolicy.Secrets.
+	// The secrets are read by LoadSecrets.
+	Secrets map[string]*SecretSource `json:"secrets,omitempty"`
+
+	// Seccomp lists the names of the seccomp profiles
+	// that are installed for all commands.
+	Seccomp []string `json:"seccomp,omitempty"`
+
+	// SeccompProfiles are custom seccomp profiles
+	// in addition to the built-in profiles of package exec
+	// like "no-network", "no-ptrace" and "no-mount".
+	// The map keys are used as profile names.
+	SeccompProfiles map[string]*exec.SeccompProfile `json:"seccompProfiles,omitempty"`
+
+	secrets map[string][]byte
+}
+
+// StopPolicy configures the signal that is sent to a command
+// to stop it and the grace period until it gets killed.
+type StopPolicy struct {
+	// Signal is one of "SIGTERM", "SIGINT", "SIGHUP" or "SIGQUIT"
+	Signal string `json:"signal"`
+	// GracePeriod is parsed with time.ParseDuration, like "10s"
+	GracePeriod string `json:"gracePeriod"`
+}
+
+func (s *StopPolicy) parse() (sig syscall.Signal, gracePeriod time.Duration, err error) {
+	switch s.Signal {
+	case "SIGTERM":
+		sig = syscall.SIGTERM
+	case "SIGINT":
+		sig = syscall.SIGINT
+	case "SIGHUP":
+		sig = syscall.SIGHUP
+	case "SIGQUIT":
+		sig = syscall.SIGQUIT
+	default:
+		return 0, 0, fmt.Errorf("invalid stop signal %q", s.Signal)
+	}
+	gracePeriod, err = time.ParseDuration(s.GracePeriod)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stop grace period: %w", err)
+	}
+	return sig, gracePeriod, nil
+}
+
+// CommandPolicy configures the execution of a single command.
+type CommandPolicy struct {
+	// Env lists the names of the environment variables
+	// that the command may set in addition to Policy.Env.
+	Env []string `json:"env,omitempty"`
+
+	// Secrets lists the names of the secrets
+	// from Policy.Secrets that the command may reference.
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Seccomp lists the names of the seccomp profiles
+	// that are installed for the command in addition
+	// to the ones of Policy.Seccomp.
+	Seccomp []string `json:"seccomp,omitempty"`
+
+	// AllowPTY allows the command to be executed
+	// with a pseudo-terminal, see Command.PTY.
+	AllowPTY bool `json:"allowPTY,omitempty"`
+
+	// Spec validates the arguments and input files
+	// of the command if not nil.
+	Spec *CommandSpec `json:"spec,omitempty"`
+
+	// SpecFile is the path of a JSON file with the Spec,
+	// relative paths are relative to the policy file.
+	// It is loaded by LoadPolicyFile.
+	SpecFile string `json:"specFile,omitempty"`
+}
+
+// NewPolicy returns a Policy that allows the passed commands
+// without any command specific configuration.
+func NewPolicy(allowedCMDs ...string) *Policy {
+	p := &Policy{Commands: make(map[string]*CommandPolicy, len(allowedCMDs))}
+	for _, cmd := range allowedCMDs {
+		p.Commands[cmd] = nil
+	}
+	return p
+}
+
+// LoadPolicyFile reads and validates a Policy from a JSON file.
+func LoadPolicyFile(file fs.File) (*Policy, error) {
+	data, err := file.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	p := new(Policy)
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse policy file %s: %w", file.Name(), err)
+	}
+	for _, cp := range p.Commands {
+		if cp == nil || cp.SpecFile == "" || cp.Spec != nil {
+			continue
+		}
+		specFile := fs.File(cp.SpecFile)
+		if !filepath.IsAbs(cp.SpecFile) {
+			specFile = file.Dir().Join(cp.SpecFile)
+		}
+		cp.Spec, err = LoadCommandSpecFile(specFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy file %s: %w", file.Name(), err)
+		}
+	}
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", file.Name(), err)
+	}
+	return p, nil
+}
+
+// Validate returns an error if the policy references
+// unknown secrets or seccomp profiles or has invalid profiles.
+func (p *Policy) Validate() error {
+	if p.Stop != nil {
+		_, _, err := p.Stop.parse()
+		if err != nil {
+			return err
+		}
+	}
+	for name, source := range p.Secrets {
+		if source == nil || (source.File == "") == (source.Env == "") {
+			return fmt.Errorf("secret %q must have either a file or an env source", name)
+		}
+	}
+	for name, profile := range p.SeccompProfiles {
+		if profile == nil {
+			return fmt.Errorf("seccomp profile %q is null", name)
+		}
+		if profile.Name == "" {
+			profile.Name = name
+		}
+		if profile.Name != name {
+			return fmt.Errorf("seccomp profile %q has different name %q", name, profile.Name)
+		}
+		err := profile.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for name, cp := range p.Commands {
+		_, err := p.seccompProfiles(name)
+		if err != nil {
+			return err
+		}
+		if cp == nil {
+			continue
+		}
+		for _, secret := range cp.Secrets {
+			if p.Secrets[secret] == nil {
+				return fmt.Errorf("command %q references unknown secret %q", name, secret)
+			}
+		}
+		if cp.Spec != nil {
+			if cp.Spec.Command != name {
+				return fmt.Errorf("command %q has spec of command %q", name, cp.Spec.Command)
+			}
+			err = cp.Spec.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSecrets reads all secrets from their sources.
+// It has to be called before executing commands
+// that reference secrets and again to reload changed secrets.
+func (p *Policy) LoadSecrets() error {
+	secrets := make(map[string][]byte, len(p.Secrets))
+	for name, source := range p.Secrets {
+		secret, err := source.read()
+		if err != nil {
+			return fmt.Errorf("can't load secret %q: %w", name, err)
+		}
+		secrets[name] = secret
+	}
+	p.secrets = secrets
+	return nil
+}
+
+// Allows returns if the command with the passed name may be executed.
+// A nil Policy allows all commands.
+func (p *Policy) Allows(cmd string) bool {
+	if p == nil {
+		return true
+	}
+	_, ok := p.Commands[cmd]
+	return ok
+}
+
+// AllowsEnv returns if the command may set
+// the environment variable with the passed name.
+// A nil Policy allows all variables.
+func (p *Policy) AllowsEnv(cmd, name string) bool {
+	if p == nil {
+		return true
+	}
+	if cp := p.Commands[cmd]; cp != nil && matchEnvName(name, cp.Env) {
+		return true
+	}
+	return matchEnvName(name, p.Env)
+}
+
+// AllowsPTY returns if the command may be
+// executed with a pseudo-terminal.
+// A nil Policy allows all commands to use a PTY.
+func (p *Policy) AllowsPTY(cmd string) bool {
+	if p == nil {
+		return true
+	}
+	cp := p.Commands[cmd]
+	return cp != nil && cp.AllowPTY
+}
+
+// checkSpec returns an error if the arguments or input files
+// of the command or the arguments of its pipeline stages
+// don't match the specs of the policy.
+// A nil Policy allows all commands.
+func (p *Policy) checkSpec(c *Command) error {
+	if p == nil {
+		return nil
+	}
+	if cp := p.Commands[c.Name]; cp != nil && cp.Spec != nil {
+		err := cp.Spec.ValidateCommand(c)
+		if err != nil {
+			return err
+		}
+	}
+	for _, stage := range c.Pipeline {
+		if cp := p.Commands[stage.Name]; cp != nil && cp.Spec != nil {
+			err := cp.Spec.ValidateArgs(stage.Args)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// secret returns the value of the named secret
+// if all of the commands may reference it.
+func (p *Policy) secret(cmds []string, name string) ([]byte, error) {
+	if p == nil {
+		return nil, fmt.Errorf("no policy for secret %q", name)
+	}
+	for _, cmd := range cmds {
+		cp := p.Commands[cmd]
+		if cp == nil || !slices.Contains(cp.Secrets, name) {
+			return nil, fmt.Errorf("secret %q not allowed for command %q", name, cmd)
+		}
+	}
+	secret, ok := p.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not loaded", name)
+	}
+	return secret, nil
+}
+
+// applyStop configures the stop sequence of cmd
+func (p *Policy) applyStop(cmd *exec.Cmd) error {
+	if p == nil || p.Stop == nil {
+		return nil
+	}
+	sig, gracePeriod, err := p.Stop.parse()
+	if err != nil {
+		return err
+	}
+	cmd.WithStopSignal(sig, gracePeriod)
+	return nil
+}
+
+func (p *Policy) outputLimit() exec.OutputLimit {
+	if p == nil || p.OutputLimit == nil {
+		return DefaultOutputLimit
+	}
+	return *p.OutputLimit
+}
+
+// seccompProfiles returns the seccomp profiles for a command
+func (p *Policy) seccompProfiles(cmd string) ([]*exec.SeccompProfile, error) {
+	if p == nil {
+		return nil, nil
+	}
+	names := p.Seccomp
+	if cp := p.Commands[cmd]; cp != nil {
+		names = append(names[:len(names):len(names)], cp.Seccomp...)
+	}
+	profiles := make([]*exec.SeccompProfile, 0, len(names))
+	for _, name := range names {
+		profile := p.SeccompProfiles[name]
+		if profile == nil {
+			profile = exec.BuiltinSeccompProfile(name)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("command %q references unknown seccomp profile %q", cmd, name)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,174 @@
+package rcom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+	"github.com/stretchr/testify/assert"
+	"github.com/ungerik/go-fs"
+)
+
+func Test_LoadPolicyFile(t *testing.T) {
+	file := fs.TempDir().Join("rcom-policy-test.json")
+	err := file.WriteAllString(`{
+		"commands": {
+			"cp": {"seccomp": ["no-ptrace", "custom"]},
+			"ls": null
+		},
+		"seccomp": ["no-network"],
+		"seccompProfiles": {
+			"custom": {"deny": ["mount"], "action": "kill"}
+		}
+	}`)
+	assert.NoError(t, err)
+	defer file.Remove()
+
+	policy, err := LoadPolicyFile(file)
+	assert.NoError(t, err)
+	assert.True(t, policy.Allows("cp"))
+	assert.True(t, policy.Allows("ls"))
+	assert.False(t, policy.Allows("rm"))
+
+	profiles, err := policy.seccompProfiles("cp")
+	assert.NoError(t, err)
+	if assert.Len(t, profiles, 3) {
+		assert.Equal(t, "no-network", profiles[0].Name)
+		assert.Equal(t, "no-ptrace", profiles[1].Name)
+		assert.Equal(t, "custom", profiles[2].Name)
+	}
+
+	err = file.WriteAllString(`{"commands": {"cp": {"seccomp": ["unknown"]}}}`)
+	assert.NoError(t, err)
+	_, err = LoadPolicyFile(file)
+	assert.Error(t, err, "unknown seccomp profile")
+}
+
+func Test_ExecuteLocallyWithPolicy(t *testing.T) {
+	command, _ := cpCommand()
+
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy("not-"+copyCmd()))
+	assert.Error(t, err, "command not allowed by policy")
+
+	_, _, err = ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy(copyCmd()))
+	assert.NoError(t, err)
+}
+
+func Test_Policy_AllowsEnv(t *testing.T) {
+	policy := &Policy{
+		Commands: map[string]*CommandPolicy{
+			"convert": {Env: []string{"MAGICK_*"}},
+			"cp":      nil,
+		},
+		Env: []string{"LC_ALL"},
+	}
+	assert.True(t, policy.AllowsEnv("cp", "LC_ALL"))
+	assert.False(t, policy.AllowsEnv("cp", "MAGICK_TMPDIR"))
+	assert.True(t, policy.AllowsEnv("convert", "MAGICK_TMPDIR"))
+	assert.True(t, policy.AllowsEnv("convert", "LC_ALL"))
+	assert.False(t, policy.AllowsEnv("convert", "AWS_SECRET_ACCESS_KEY"))
+
+	command, _ := cpCommand()
+	command.Env = []EnvVar{{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret", Sensitive: true}}
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy(copyCmd()))
+	assert.Error(t, err, "environment variable not allowed by policy")
+}
+
+func Test_Policy_AllowsPTY(t *testing.T) {
+	policy := &Policy{
+		Commands: map[string]*CommandPolicy{
+			"legacy-tool": {AllowPTY: true},
+			"cp":          nil,
+		},
+	}
+	assert.True(t, policy.AllowsPTY("legacy-tool"))
+	assert.False(t, policy.AllowsPTY("cp"))
+	assert.False(t, policy.AllowsPTY("rm"))
+
+	command, _ := cpCommand()
+	command.PTY = &exec.PTY{}
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy(copyCmd()))
+	assert.Error(t, err, "PTY not allowed by policy")
+}
+
+func Test_commandEnv(t *testing.T) {
+	t.Setenv("RCOM_TEST_SECRET", "secret")
+
+	env := commandEnv("/work", "/work/tmp", []EnvVar{{Name: "FOO", Value: "bar"}})
+	assert.Contains(t, env, "HOME=/work")
+	assert.Contains(t, env, "TMPDIR=/work/tmp")
+	assert.Contains(t, env, "FOO=bar")
+	for _, v := range env {
+		assert.NotContains(t, v, "RCOM_TEST_SECRET", "environment of the executing process is not inherited")
+	}
+
+	assert.Equal(t, "KEY=***", EnvVar{Name: "KEY", Value: "secret", Sensitive: true}.String())
+}
+
+func Test_Policy_Secrets(t *testing.T) {
+	t.Setenv("RCOM_TEST_SECRET", "secret-value")
+
+	policy := &Policy{
+		Commands: map[string]*CommandPolicy{
+			copyCmd(): {Secrets: []string{"test"}},
+		},
+		Secrets: map[string]*SecretSource{
+			"test": {Env: "RCOM_TEST_SECRET"},
+		},
+	}
+	assert.NoError(t, policy.Validate())
+
+	command := &Command{
+		Name:    copyCmd(),
+		Args:    []string{"secret.txt", "output.txt"},
+		Secrets: []SecretRef{{Name: "test", FileName: "secret.txt"}},
+	}
+	_, _, err := ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	assert.Error(t, err, "secrets not loaded")
+
+	assert.NoError(t, policy.LoadSecrets())
+	result, _, err := ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	assert.NoError(t, err)
+	assert.NotContains(t, result.Files, "secret.txt", "secret file is not returned")
+	assert.Equal(t, []byte("secret-value"), result.Files["output.txt"], "result files are not masked")
+
+	policy.Commands["sort"] = &CommandPolicy{}
+	command.Pipeline = []PipelineStage{{Name: "sort"}}
+	_, _, err = ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	assert.ErrorContains(t, err, `secret "test" not allowed for command "sort"`)
+	command.Pipeline = nil
+
+	_, _, err = ExecuteLocallyWithPolicy(context.Background(), command, NewPolicy(copyCmd()))
+	assert.Error(t, err, "secret not allowed for command")
+
+	policy.Commands["ls"] = &CommandPolicy{Secrets: []string{"unknown"}}
+	assert.Error(t, policy.Validate(), "unknown secret")
+}
+
+func Test_Command_Validate_Secrets(t *testing.T) {
+	valid := &Command{
+		Name:    copyCmd(),
+		Secrets: []SecretRef{{Name: "test", FileName: "secret.txt"}},
+	}
+	assert.NoError(t, valid.Validate())
+
+	invalid := map[string]*Command{
+		"dot":            {Name: copyCmd(), Secrets: []SecretRef{{Name: "test", FileName: "."}}},
+		"dot dot":        {Name: copyCmd(), Secrets: []SecretRef{{Name: "test", FileName: ".."}}},
+		"separator":      {Name: copyCmd(), Secrets: []SecretRef{{Name: "test", FileName: "dir/secret.txt"}}},
+		"backslash":      {Name: copyCmd(), Secrets: []SecretRef{{Name: "test", FileName: `dir\secret.txt`}}},
+		"input file":     {Name: copyCmd(), Files: map[string][]byte{"secret.txt": nil}, Secrets: valid.Secrets},
+		"stdout file":    {Name: copyCmd(), StdoutFile: "secret.txt", Secrets: valid.Secrets},
+		"stderr file":    {Name: copyCmd(), StderrFile: "secret.txt", Secrets: valid.Secrets},
+		"duplicate":      {Name: copyCmd(), Secrets: []SecretRef{{Name: "a", FileName: "secret.txt"}, {Name: "b", FileName: "secret.txt"}}},
+		"no file or env": {Name: copyCmd(), Secrets: []SecretRef{{Name: "test"}}},
+	}
+	for name, command := range invalid {
+		assert.Error(t, command.Validate(), name)
+	}
+}
+
+func Test_redactor(t *testing.T) {
+	r := newRedactor([][]byte{[]byte("key\n"), []byte("longer-key")})
+	assert.Equal(t, "a *** b ***\nc", r.redact("a longer-key b key\nc"))
+}
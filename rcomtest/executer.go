@@ -0,0 +1,143 @@
+// Package rcomtest provides utilities for testing code that uses rcom.
+package rcomtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	rcom "github.com/domonda/go-rcom"
+)
+
+// Executer is a scriptable fake rcom.Executer.
+// Commands are matched against the rules added with On and OnName
+// in the order the rules were added and every call is recorded.
+// Executer is safe for concurrent use.
+type Executer struct {
+	mtx   sync.Mutex
+	rules []*Rule
+	calls []Call
+}
+
+var _ rcom.Executer = new(Executer)
+
+// NewExecuter returns a fake Executer without rules.
+func NewExecuter() *Executer {
+	return new(Executer)
+}
+
+// Rule defines the result for matching commands.
+// A rule without Return or ReturnError returns
+// an empty Result with exit code zero.
+type Rule struct {
+	name    string
+	args    []string
+	anyArgs bool
+	result  func(context.Context, *rcom.Command) (*rcom.Result, error)
+}
+
+// Call is a recorded call of Executer.Execute
+type Call struct {
+	Command *rcom.Command
+	Result  *rcom.Result
+	Err     error
+}
+
+// On adds a rule for commands with the passed name
+// and exactly the passed arguments.
+func (e *Executer) On(name string, args ...string) *Rule {
+	return e.addRule(&Rule{name: name, args: args})
+}
+
+// OnName adds a rule for commands with
+// the passed name and any arguments.
+func (e *Executer) OnName(name string) *Rule {
+	return e.addRule(&Rule{name: name, anyArgs: true})
+}
+
+func (e *Executer) addRule(r *Rule) *Rule {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.rules = append(e.rules, r)
+	return r
+}
+
+// Return sets the result returned for matching commands.
+// Every call returns a shallow copy of the result.
+func (r *Rule) Return(result *rcom.Result) *Rule {
+	return r.ReturnFunc(func(context.Context, *rcom.Command) (*rcom.Result, error) {
+		r := *result
+		return &r, nil
+	})
+}
+
+// ReturnError sets the error returned for matching commands.
+func (r *Rule) ReturnError(err error) *Rule {
+	return r.ReturnFunc(func(context.Context, *rcom.Command) (*rcom.Result, error) {
+		return nil, err
+	})
+}
+
+// ReturnFunc sets a function that is called
+// for matching commands to return the result.
+func (r *Rule) ReturnFunc(f func(context.Context, *rcom.Command) (*rcom.Result, error)) *Rule {
+	r.result = f
+	return r
+}
+
+func (r *Rule) matches(cmd *rcom.Command) bool {
+	return cmd.Name == r.name && (r.anyArgs || slices.Equal(cmd.Args, r.args))
+}
+
+// Execute implements rcom.Executer by returning the result
+// of the first matching rule or an error if no rule matches.
+func (e *Executer) Execute(ctx context.Context, cmd *rcom.Command) (result *rcom.Result, err error) {
+	e.mtx.Lock()
+	var rule *Rule
+	for _, r := range e.rules {
+		if r.matches(cmd) {
+			rule = r
+			break
+		}
+	}
+	e.mtx.Unlock()
+
+	switch {
+	case rule == nil:
+		err = fmt.Errorf("rcomtest: unexpected command: %s", cmd)
+	case rule.result == nil:
+		result = new(rcom.Result)
+	default:
+		result, err = rule.result(ctx, cmd)
+	}
+
+	e.mtx.Lock()
+	e.calls = append(e.calls, Call{Command: cmd, Result: result, Err: err})
+	e.mtx.Unlock()
+
+	return result, err
+}
+
+// Calls returns all recorded calls in the order they were made.
+func (e *Executer) Calls() []Call {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return slices.Clone(e.calls)
+}
+
+// CallsTo returns the recorded calls of commands with the passed name.
+func (e *Executer) CallsTo(name string) []Call {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	var calls []Call
+	for _, call := range e.calls {
+		if call.Command.Name == name {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
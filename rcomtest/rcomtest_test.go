@@ -0,0 +1,69 @@
+package rcomtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rcom "github.com/domonda/go-rcom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	Main(m)
+}
+
+func Test_Executer(t *testing.T) {
+	errFailed := errors.New("failed")
+	e := NewExecuter()
+	e.On("convert", "a.png", "a.pdf").Return(&rcom.Result{ExitCode: 0, Output: "converted"})
+	e.On("convert", "b.png", "b.pdf").ReturnError(errFailed)
+	e.OnName("pdftotext").Return(&rcom.Result{Stdout: "text"})
+
+	result, err := e.Execute(context.Background(), &rcom.Command{Name: "convert", Args: []string{"a.png", "a.pdf"}})
+	require.NoError(t, err)
+	assert.Equal(t, "converted", result.Output)
+
+	_, err = e.Execute(context.Background(), &rcom.Command{Name: "convert", Args: []string{"b.png", "b.pdf"}})
+	assert.ErrorIs(t, err, errFailed)
+
+	result, err = e.Execute(context.Background(), &rcom.Command{Name: "pdftotext", Args: []string{"-layout", "x.pdf"}})
+	require.NoError(t, err)
+	assert.Equal(t, "text", result.Stdout)
+
+	_, err = e.Execute(context.Background(), &rcom.Command{Name: "convert", Args: []string{"c.png"}})
+	assert.Error(t, err, "no matching rule")
+
+	assert.Len(t, e.Calls(), 4)
+	calls := e.CallsTo("convert")
+	require.Len(t, calls, 3)
+	assert.Equal(t, []string{"b.png", "b.pdf"}, calls[1].Command.Args)
+	assert.ErrorIs(t, calls[1].Err, errFailed)
+}
+
+func Test_NewServer(t *testing.T) {
+	server := NewServer(t, "go")
+
+	result, err := server.Client.ExecuteArgs(context.Background(), []string{"version"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, result.Stdout, "go version")
+
+	_, err = server.Client.ExecuteWithCommand(context.Background(), "rm", nil, nil)
+	assert.Error(t, err, "command not allowed")
+}
+
+func Test_RunExecuterSuite(t *testing.T) {
+	t.Run("Local", func(t *testing.T) {
+		RunExecuterSuite(t, rcom.LocalExecuter())
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		server := NewServer(t, TestCmd(t))
+		RunExecuterSuite(t, rcom.RemoteExecuter(server.URL))
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		RunExecuterSuite(t, NewServer(t, TestCmd(t)).Client)
+	})
+}
@@ -0,0 +1,50 @@
+package rcomtest
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	rcom "github.com/domonda/go-rcom"
+)
+
+// Server is an in-process rcom server that
+// executes the allowed commands on the local machine.
+type Server struct {
+	*httptest.Server
+
+	// Client is configured for the server
+	// and allows the same commands as the server.
+	Client *rcom.Client
+}
+
+// NewServer starts a Server that executes the allowed commands.
+// The server is closed when the test and all its subtests complete.
+func NewServer(t testing.TB, allowedCMDs ...string) *Server {
+	t.Helper()
+
+	handler, err := rcom.NewHandler(rcom.NewPolicy(allowedCMDs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		Server: server,
+		Client: rcom.NewClient(
+			rcom.ClientWithCmds(allowedCMDs...),
+			rcom.ClientWithHost(u.Hostname()),
+			rcom.ClientWithPort(uint16(port)),
+		),
+	}
+}
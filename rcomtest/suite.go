@@ -0,0 +1,301 @@
+package rcomtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	rcom "github.com/domonda/go-rcom"
+)
+
+// TestCmdEnv is the name of the environment variable
+// that can be set to the path of a prebuilt
+// github.com/domonda/go-rcom/cmd/rcom-test-cmd executable
+// so that tests don't need the go tool to build it.
+const TestCmdEnv = "RCOM_TEST_CMD"
+
+var (
+	testCmdOnce sync.Once
+	testCmdPath string
+	testCmdDir  string
+	testCmdErr  error
+)
+
+// buildTestCmd returns the executable from TestCmdEnv
+// or builds it once with the go tool into a temp directory.
+func buildTestCmd() (string, error) {
+	testCmdOnce.Do(func() {
+		if path := os.Getenv(TestCmdEnv); path != "" {
+			testCmdPath = path
+			return
+		}
+		testCmdDir, testCmdErr = os.MkdirTemp("", "rcom-test-cmd")
+		if testCmdErr != nil {
+			return
+		}
+		testCmdPath = filepath.Join(testCmdDir, "rcom-test-cmd")
+		if runtime.GOOS == "windows" {
+			testCmdPath += ".exe"
+		}
+		out, err := exec.Command("go", "build", "-o", testCmdPath, "github.com/domonda/go-rcom/cmd/rcom-test-cmd").CombinedOutput()
+		if err != nil {
+			testCmdErr = fmt.Errorf("can't build rcom-test-cmd: %w: %s", err, out)
+		}
+	})
+	return testCmdPath, testCmdErr
+}
+
+// Main builds the executable returned by TestCmd,
+// runs the tests and removes the executable again.
+// Use it as TestMain of packages that use RunExecuterSuite
+// so that the executable is built only once before the tests
+// and the build does not count towards their timeouts:
+//
+//	func TestMain(m *testing.M) {
+//		rcomtest.Main(m)
+//	}
+func Main(m *testing.M) {
+	_, err := buildTestCmd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	if testCmdDir != "" {
+		os.RemoveAll(testCmdDir)
+	}
+	os.Exit(code)
+}
+
+// TestCmd returns the path of the
+// github.com/domonda/go-rcom/cmd/rcom-test-cmd executable
+// from the environment variable TestCmdEnv or builds it once
+// with the go tool if it was not already built by Main.
+// The executable is used by RunExecuterSuite,
+// so servers tested with the suite have to allow it.
+func TestCmd(t testing.TB) string {
+	t.Helper()
+	path, err := buildTestCmd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// RunExecuterSuite runs conformance tests as subtests of t
+// that check that the executer behaves like rcom.LocalExecuter.
+// The executer has to allow the command returned by TestCmd.
+func RunExecuterSuite(t *testing.T, executer rcom.Executer) {
+	cmd := TestCmd(t)
+	ctx := context.Background()
+
+	execute := func(t *testing.T, command *rcom.Command) *rcom.Result {
+		t.Helper()
+		result, err := executer.Execute(ctx, command)
+		if err != nil {
+			t.Fatalf("%s: %s", command, err)
+		}
+		if result == nil {
+			t.Fatalf("%s: nil result without error", command)
+		}
+		return result
+	}
+
+	t.Run("Stdout and Stderr", func(t *testing.T) {
+		result := execute(t, &rcom.Command{
+			Name: cmd,
+			Args: []string{"-wait=0", "-stdout=Hello", "-stderr=World"},
+		})
+		checkEqual(t, "exit code", 0, result.ExitCode)
+		checkEqual(t, "stdout", "Hello\n", result.Stdout)
+		checkEqual(t, "stderr", "World\n", result.Stderr)
+	})
+
+	t.Run("Stdin", func(t *testing.T) {
+		result := execute(t, &rcom.Command{
+			Name:  cmd,
+			Args:  []string{"-wait=0", "-stdin"},
+			Stdin: []byte("Hello Stdin"),
+		})
+		checkEqual(t, "stdout", "Hello Stdin", result.Stdout)
+	})
+
+	t.Run("ResultFilePatterns", func(t *testing.T) {
+		command := &rcom.Command{
+			Name:               cmd,
+			Args:               []string{"-wait=0", "-createFiles=a.txt,b.pdf,sub/c.txt"},
+			ResultFilePatterns: []string{"*.txt"},
+		}
+		result := execute(t, command)
+		checkFiles(t, result, "a.txt")
+
+		command.ResultFilePatterns = []string{"**/*.txt"}
+		result = execute(t, command)
+		checkFiles(t, result, "a.txt", "sub/c.txt")
+
+		command.ResultFilePatterns = nil
+		result = execute(t, command)
+		checkFiles(t, result, "a.txt", "b.pdf")
+	})
+
+	t.Run("Empty files", func(t *testing.T) {
+		result := execute(t, &rcom.Command{
+			Name:               cmd,
+			Args:               []string{"-wait=0", "-copy=empty.in:empty.out"},
+			Files:              map[string][]byte{"empty.in": nil},
+			ResultFilePatterns: []string{"*.out"},
+		})
+		checkFiles(t, result, "empty.out")
+		checkEqual(t, "length of empty.out", 0, len(result.Files["empty.out"]))
+	})
+
+	t.Run("Large files", func(t *testing.T) {
+		data := make([]byte, 16<<20)
+		_, _ = rand.Read(data)
+		result := execute(t, &rcom.Command{
+			Name:               cmd,
+			Args:               []string{"-wait=0", "-copy=large.in:large.out"},
+			Files:              map[string][]byte{"large.in": data},
+			ResultFilePatterns: []string{"*.out"},
+		})
+		checkFiles(t, result, "large.out")
+		if !bytes.Equal(result.Files["large.out"], data) {
+			t.Errorf("large.out has %d bytes different from the %d input bytes", len(result.Files["large.out"]), len(data))
+		}
+	})
+
+	t.Run("NonErrorExitCodes", func(t *testing.T) {
+		command := &rcom.Command{
+			Name: cmd,
+			Args: []string{"-wait=0", "-exitCode=3"},
+		}
+		_, err := executer.Execute(ctx, command)
+		if err == nil {
+			t.Error("expected error for exit code 3")
+		}
+
+		command.NonErrorExitCodes = map[int]bool{3: true}
+		result := execute(t, command)
+		checkEqual(t, "exit code", 3, result.ExitCode)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		command := &rcom.Command{Name: cmd, Args: []string{"-wait=10s"}}
+		// Sub-processes are only killed on Unix systems
+		var socket string
+		if runtime.GOOS != "windows" {
+			// Not within t.TempDir() because the path
+			// of a unix domain socket has to be short
+			dir, err := os.MkdirTemp("", "rcom")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(dir) })
+			socket = filepath.Join(dir, "sub-process")
+			command.Args = append(command.Args, "-spawn="+socket)
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := executer.Execute(ctx, command)
+			errc <- err
+		}()
+		if socket != "" {
+			// The sub-process accepts connections as soon as it runs
+			ready := waitFor(10*time.Second, errc, func() bool { return dialUnix(socket) })
+			if !ready {
+				t.Fatal("sub-process did not start")
+			}
+		} else {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		cancel()
+		start := time.Now()
+		err := <-errc
+		if err == nil {
+			t.Fatal("expected error for canceled command")
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("canceled command returned after %s", d)
+		}
+
+		if socket != "" && !waitFor(time.Second, nil, func() bool { return !dialUnix(socket) }) {
+			t.Error("sub-process was not killed")
+		}
+	})
+
+	t.Run("Validation errors", func(t *testing.T) {
+		for _, command := range []*rcom.Command{
+			{Name: ""},
+			{Name: cmd, Files: map[string][]byte{"../escape.txt": nil}},
+			{Name: cmd, Files: map[string][]byte{"/absolute.txt": nil}},
+			{Name: cmd, ResultFilePatterns: []string{"../*"}},
+		} {
+			_, err := executer.Execute(ctx, command)
+			if err == nil {
+				t.Errorf("expected validation error for %#v", command)
+			}
+		}
+	})
+}
+
+// waitFor polls condition until it returns true and
+// returns false if that did not happen within timeout
+// or if abort received a value.
+func waitFor(timeout time.Duration, abort <-chan error, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-abort:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// dialUnix returns if a process accepts
+// connections on the unix domain socket.
+func dialUnix(socket string) bool {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func checkEqual[T comparable](t *testing.T, what string, expected, actual T) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("expected %s %#v but got %#v", what, expected, actual)
+	}
+}
+
+func checkFiles(t *testing.T, result *rcom.Result, names ...string) {
+	t.Helper()
+	if len(result.Files) != len(names) {
+		t.Errorf("expected result files %v but got %d files", names, len(result.Files))
+	}
+	for _, name := range names {
+		if _, ok := result.Files[name]; !ok {
+			t.Errorf("missing result file %q", name)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package rcom
+
+import (
+	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
+)
+
+// Report holds the timing and resource usage of a command execution.
+type Report struct {
+	// Usage of the executed process
+	exec.Usage
+
+	// Phases of the execution
+	Phases Phases
+}
+
+// Phases holds the durations of the phases of a command execution.
+// Phases that don't happen, like Decode, Queue and Encode
+// for local executions, are zero.
+type Phases struct {
+	// Decode is the duration the server needed
+	// to receive and decode the command
+	Decode time.Duration
+	// Queue is the duration the server waited
+	// until a command could be executed
+	Queue time.Duration
+	// WriteInputs is the duration of creating the working
+	// directory and writing the input files
+	WriteInputs time.Duration
+	// Exec is the duration from starting the command until it exited
+	Exec time.Duration
+	// CollectResults is the duration of reading the result files
+	CollectResults time.Duration
+	// Encode is the duration the server needed
+	// to encode and send the result
+	Encode time.Duration
+}
+
+// encodeDurationTrailer is the HTTP trailer used by the server
+// to send Phases.Encode after the encoded result
+const encodeDurationTrailer = "Rcom-Encode-Duration"
+
+// exitErrorHeader is the HTTP header used by the server
+// to send the JSON encoded *exec.ExitError of a command
+// that exited with an error exit code
+const exitErrorHeader = "Rcom-Exit-Error"
+
+// pipelineErrorHeader is set by the server if the body
+// of an error response is a gob encoded *PipelineError
+// instead of the error message
+const pipelineErrorHeader = "Rcom-Pipeline-Error"
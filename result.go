@@ -3,6 +3,7 @@ package rcom
 import (
 	"fmt"
 
+	"github.com/domonda/go-rcom/pkg/exec"
 	"github.com/domonda/go-types/uu"
 	"github.com/ungerik/go-fs"
 )
@@ -13,10 +14,87 @@ type Result struct {
 	Output   string
 	Stdout   string
 	Stderr   string
-	Files    map[string][]byte
-	_        struct{}
+
+	// OutputTruncated, StdoutTruncated and StderrTruncated
+	// tell if the outputs were truncated because
+	// of the output limit of the executing server.
+	OutputTruncated bool
+	StdoutTruncated bool
+	StderrTruncated bool
+
+	// StdoutBytes and StderrBytes are the total number of bytes
+	// written by the command independent of truncation.
+	StdoutBytes int64
+	StderrBytes int64
+
+	Files map[string][]byte
+
+	// SkippedFiles maps the names of files that matched
+	// the result file patterns but were not returned
+	// to the reason why they were skipped,
+	// like "symbolic link pointing outside of the working directory".
+	SkippedFiles map[string]string
+
+	// Report holds the timing and resource usage of the execution
+	Report Report
+
+	// KilledBySeccomp holds the comma separated names
+	// of the seccomp profiles that could have killed
+	// the process because of a blocked syscall.
+	// With multiple kill profiles it is not known which
+	// of them blocked the syscall, see exec.Result.KilledBySeccomp.
+	KilledBySeccomp string
+
+	// Signal is the name of the signal like "SIGSEGV"
+	// that terminated the command or empty
+	// if the command exited by itself.
+	Signal string
+	// CoreDumped tells if the terminated command dumped a core
+	CoreDumped bool
+	// StopReason tells why the command was stopped
+	// or empty if it was not stopped
+	StopReason exec.StopReason
+
+	// Stages holds the results of all commands
+	// if the command was executed as a pipeline.
+	// ExitCode, Output, Stdout and Stderr of the Result
+	// are those of the last command.
+	Stages []StageResult
+
+	_ struct{}
+}
+
+// StageResult is the result of a command of a pipeline
+type StageResult struct {
+	Name            string
+	ExitCode        int
+	Stderr          string
+	KilledBySeccomp string
+	Signal          string
+}
+
+// PipelineError is returned if a command of a Command.Pipeline failed.
+// It holds the results of all commands of the pipeline
+// and wraps the *exec.ExitError of the failed command.
+type PipelineError struct {
+	// Stage is the index of the failed command in Stages
+	Stage   int
+	Stages  []StageResult
+	ExitErr *exec.ExitError
+	// Output of the failed command
+	Output string
+}
+
+func (e *PipelineError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Stages[e.Stage].Name, e.ExitErr)
+	if e.Output != "" {
+		msg += "\nCommand output: " + e.Output
+	}
+	return msg
 }
 
+func (e *PipelineError) Unwrap() error { return e.ExitErr }
+
 func (r *Result) WriteTo(output fs.File) error {
 	rf := r.Files[output.Name()]
 	switch {
@@ -27,3 +105,32 @@ func (r *Result) WriteTo(output fs.File) error {
 	}
 	return output.WriteAll(rf)
 }
+
+// FilesMatching returns the result files
+// matching the result file pattern
+// or nil if no file matches.
+func (r *Result) FilesMatching(pattern string) map[string][]byte {
+	var files map[string][]byte
+	for name, data := range r.Files {
+		if matchFilePattern(pattern, name) {
+			if files == nil {
+				files = make(map[string][]byte)
+			}
+			files[name] = data
+		}
+	}
+	return files
+}
+
+// size returns the number of bytes of the outputs
+// and files of the result held in memory.
+func (r *Result) size() int64 {
+	if r == nil {
+		return 0
+	}
+	n := int64(len(r.Output) + len(r.Stdout) + len(r.Stderr))
+	for name, data := range r.Files {
+		n += int64(len(name) + len(data))
+	}
+	return n
+}
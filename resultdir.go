@@ -0,0 +1,264 @@
+package rcom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ungerik/go-fs"
+)
+
+// FileOverwrite is the policy for result files
+// that already exist in the destination directory.
+type FileOverwrite int
+
+const (
+	// OverwriteFiles replaces existing files
+	OverwriteFiles FileOverwrite = iota
+	// SkipExistingFiles keeps existing files
+	// and does not write the result file
+	SkipExistingFiles
+	// ErrorOnExistingFiles returns an error
+	// if a result file already exists
+	ErrorOnExistingFiles
+)
+
+// WriteFilesOptions select and map the result files
+// written to a destination directory.
+type WriteFilesOptions struct {
+	// Patterns select the result files to write
+	// like Command.ResultFilePatterns.
+	// All files are written if empty.
+	Patterns []string
+
+	// Rename maps the name of a result file to its
+	// slash separated path in the destination directory.
+	// The file is not written if Rename returns an empty string.
+	// Files keep their names if Rename is nil.
+	Rename func(name string) string
+
+	// Overwrite is the policy for existing files
+	Overwrite FileOverwrite
+}
+
+// destination returns the file for the result file name
+// in dir or false if the file should not be written.
+func (o *WriteFilesOptions) destination(dir fs.File, name string) (fs.File, bool, error) {
+	if err := validateFilePath(name); err != nil {
+		return "", false, err
+	}
+	if len(o.Patterns) > 0 && !slices.ContainsFunc(o.Patterns, func(pattern string) bool { return matchFilePattern(pattern, name) }) {
+		return "", false, nil
+	}
+	if o.Rename != nil {
+		name = o.Rename(name)
+		if name == "" {
+			return "", false, nil
+		}
+		if err := validateFilePath(name); err != nil {
+			return "", false, fmt.Errorf("renamed result file: %w", err)
+		}
+	}
+	file := dir.Join(strings.Split(name, "/")...)
+	if file.Exists() {
+		switch o.Overwrite {
+		case SkipExistingFiles:
+			return "", false, nil
+		case ErrorOnExistingFiles:
+			return "", false, fmt.Errorf("result file already exists: %s", file)
+		}
+	}
+	return file, true, nil
+}
+
+// writeResultFile writes the data read from r to file
+// after creating its parent directories.
+func writeResultFile(file fs.File, r io.Reader) error {
+	err := file.Dir().MakeAllDirs()
+	if err != nil {
+		return err
+	}
+	w, err := file.OpenWriter()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// WriteFilesTo writes the result files selected by opts
+// into the directory dir, creating sub directories as needed.
+// In contrast to WriteTo empty result files are written.
+// The written files are returned in the order of their result file names.
+func (r *Result) WriteFilesTo(dir fs.File, opts WriteFilesOptions) (written []fs.File, err error) {
+	names := make([]string, 0, len(r.Files))
+	for name := range r.Files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		file, ok, err := opts.destination(dir, name)
+		if err != nil {
+			return written, fmt.Errorf("%w, callID=%v", err, r.CallID)
+		}
+		if !ok {
+			continue
+		}
+		err = writeResultFile(file, bytes.NewReader(r.Files[name]))
+		if err != nil {
+			return written, err
+		}
+		written = append(written, file)
+	}
+	return written, nil
+}
+
+// streamFilesContentType is requested with the Accept header
+// to receive the result files as separate parts after the
+// encoded result instead of within Result.Files
+const streamFilesContentType = "multipart/mixed"
+
+// fileNameHeader is the MIME header of a streamed result file part
+// holding the slash separated name of the result file
+const fileNameHeader = "Rcom-File-Name"
+
+// acceptsStreamedFiles returns if the request
+// accepts streamed result files.
+func acceptsStreamedFiles(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(accept); mediaType == streamFilesContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStreamedFiles writes the response to w as multipart message
+// with the gob encoded result without files as first part
+// followed by a part for every result file.
+// The result files are written from response.Files,
+// so the server still holds all of them in memory
+// because executers return results with their files.
+func encodeStreamedFiles(w http.ResponseWriter, response *Result) error {
+	files := response.Files
+	response.Files = nil
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mime.FormatMediaType(streamFilesContentType, map[string]string{"boundary": mw.Boundary()}))
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/x-gob"}})
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(part).Encode(response)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		part, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/octet-stream"},
+			fileNameHeader: {name},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(files[name])
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// filesDestination receives streamed result files
+type filesDestination struct {
+	dir     fs.File
+	opts    WriteFilesOptions
+	written []fs.File
+	// created are the written files that did not exist before
+	created []fs.File
+}
+
+// decodeStreamedFiles reads a response written by encodeStreamedFiles
+// and writes the result files to the destination part by part.
+func (d *filesDestination) decodeStreamedFiles(response *http.Response) (result *Result, err error) {
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != streamFilesContentType || params["boundary"] == "" {
+		return nil, fmt.Errorf("rcom.Command: unexpected response content type %q", mediaType)
+	}
+	mr := multipart.NewReader(response.Body, params["boundary"])
+
+	part, err := mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	err = gob.NewDecoder(part).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err = mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		file, ok, err := d.opts.destination(d.dir, part.Header.Get(fileNameHeader))
+		if err != nil {
+			return nil, fmt.Errorf("%w, callID=%v", err, result.CallID)
+		}
+		if !ok {
+			continue
+		}
+		// Added before writing so that a partially
+		// written file is removed if the call fails
+		if !file.Exists() {
+			d.created = append(d.created, file)
+		}
+		d.written = append(d.written, file)
+		err = writeResultFile(file, part)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeCreated removes the files that were created by a failed call
+// so that calling it again does not find them as existing files.
+// Existing files that were overwritten are kept.
+func (d *filesDestination) removeCreated() error {
+	for _, file := range d.created {
+		err := file.Remove()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		d.written = slices.DeleteFunc(d.written, func(f fs.File) bool { return f == file })
+	}
+	d.created = nil
+	return nil
+}
@@ -0,0 +1,129 @@
+package rcom
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ungerik/go-fs"
+)
+
+func Test_Result_WriteFilesTo(t *testing.T) {
+	result := &Result{Files: map[string][]byte{
+		"a.txt":        []byte("a"),
+		"empty.txt":    {},
+		"sub/b.txt":    []byte("b"),
+		"sub/skip.log": []byte("log"),
+	}}
+
+	dir := fs.File(t.TempDir())
+	written, err := result.WriteFilesTo(dir, WriteFilesOptions{Patterns: []string{"**/*.txt"}})
+	require.NoError(t, err)
+	assert.Equal(t, []fs.File{dir.Join("a.txt"), dir.Join("empty.txt"), dir.Join("sub", "b.txt")}, written)
+	data, err := dir.Join("sub", "b.txt").ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+	assert.True(t, dir.Join("empty.txt").Exists(), "empty files are written")
+	assert.False(t, dir.Join("sub", "skip.log").Exists())
+
+	rename := func(name string) string {
+		if name == "a.txt" {
+			return "renamed/a.txt"
+		}
+		return ""
+	}
+	written, err = result.WriteFilesTo(dir, WriteFilesOptions{Rename: rename})
+	require.NoError(t, err)
+	assert.Equal(t, []fs.File{dir.Join("renamed", "a.txt")}, written)
+
+	// Overwrite policies
+	require.NoError(t, dir.Join("a.txt").WriteAllString("existing"))
+	onlyA := WriteFilesOptions{Patterns: []string{"a.txt"}, Overwrite: SkipExistingFiles}
+	written, err = result.WriteFilesTo(dir, onlyA)
+	require.NoError(t, err)
+	assert.Empty(t, written)
+	data, err = dir.Join("a.txt").ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(data))
+
+	onlyA.Overwrite = ErrorOnExistingFiles
+	_, err = result.WriteFilesTo(dir, onlyA)
+	assert.Error(t, err)
+
+	onlyA.Overwrite = OverwriteFiles
+	_, err = result.WriteFilesTo(dir, onlyA)
+	require.NoError(t, err)
+	data, err = dir.Join("a.txt").ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+
+	// Renamed files must stay within the directory
+	_, err = result.WriteFilesTo(dir, WriteFilesOptions{Rename: func(name string) string { return "../" + name }})
+	assert.Error(t, err)
+}
+
+func Test_Client_ExecuteToDir(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer server.Close()
+	client := NewClient(ClientWithCmds(copyCmd()), ClientWithBaseURL(server.URL))
+
+	command, expectedFile := cpCommand()
+	dir := fs.File(t.TempDir())
+	result, written, err := client.ExecuteToDir(context.Background(), command, dir, WriteFilesOptions{
+		Patterns: []string{expectedFile.Name()},
+		Rename:   func(name string) string { return "results/" + name },
+	})
+	require.NoError(t, err)
+	assert.Nil(t, result.Files, "files are not buffered")
+	assert.NotZero(t, result.CallID)
+	file := dir.Join("results", expectedFile.Name())
+	assert.Equal(t, []fs.File{file}, written)
+	data, err := file.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, data)
+	assert.False(t, dir.Join("results", "input.txt").Exists(), "filtered by pattern")
+}
+
+func Test_Client_ExecuteToDir_truncated(t *testing.T) {
+	service := &service{policy: NewPolicy(copyCmd())}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// Cut off the response within the closing boundary
+		// after the result file was received
+		recorder := httptest.NewRecorder()
+		service.ServeHTTP(recorder, r)
+		w.Header().Set("Content-Type", recorder.Header().Get("Content-Type"))
+		body := recorder.Body.Bytes()
+		w.Write(body[:len(body)-8])
+	}))
+	defer server.Close()
+	client := NewClient(
+		ClientWithCmds(copyCmd()),
+		ClientWithBaseURL(server.URL),
+		ClientWithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+
+	command, expectedFile := cpCommand()
+	dir := fs.File(t.TempDir())
+	filesOpts := WriteFilesOptions{Patterns: []string{expectedFile.Name()}}
+	_, written, err := client.ExecuteToDir(context.Background(), command, dir, filesOpts)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, int32(1), requests.Load(), "not retried after the response was received")
+	assert.Empty(t, written)
+	assert.False(t, dir.Join(expectedFile.Name()).Exists(), "created file removed")
+
+	// Existing files that were overwritten are not removed
+	file := dir.Join(expectedFile.Name())
+	require.NoError(t, file.WriteAllString("existing"))
+	_, written, err = client.ExecuteToDir(context.Background(), command, dir, filesOpts)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, []fs.File{file}, written)
+	assert.True(t, file.Exists(), "overwritten file kept")
+}
@@ -0,0 +1,142 @@
+package rcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ungerik/go-fs"
+)
+
+// errSkipResultFile is wrapped by errors describing
+// why a file is not returned as result file
+var errSkipResultFile = errors.New("skipped result file")
+
+// collectResultFiles reads the files of dir that match one of the patterns
+// using their slash separated paths relative to dir as map keys.
+// Only top level files are read if there are no patterns
+// or no pattern can match files in sub directories.
+// The directory skipDir is never read.
+//
+// Symbolic links are only followed to regular files within dir.
+// Matching files that are not read because they are
+// symbolic links pointing elsewhere, FIFOs, sockets or devices
+// are returned as skipped map with the reason as value.
+func collectResultFiles(ctx context.Context, dir fs.File, patterns []string, skipDir fs.File) (files map[string][]byte, skipped map[string]string, err error) {
+	recursive := slices.ContainsFunc(patterns, isRecursiveFilePattern)
+	root := dir.MustLocalPath()
+	// Resolve symbolic links in the path of root
+	// to be able to check if link targets are within root
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	files = make(map[string][]byte)
+	err = filepath.WalkDir(root, func(path string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if entry.IsDir() {
+			if !recursive || path == skipDir.MustLocalPath() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if len(patterns) > 0 && !slices.ContainsFunc(patterns, func(p string) bool { return matchFilePattern(p, name) }) {
+			return nil
+		}
+		data, err := readResultFile(path, entry.Type(), realRoot)
+		if errors.Is(err, errSkipResultFile) {
+			if skipped == nil {
+				skipped = make(map[string]string)
+			}
+			skipped[name] = strings.TrimPrefix(err.Error(), errSkipResultFile.Error()+": ")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, skipped, nil
+}
+
+// readResultFile reads a regular file or a symbolic link
+// to a regular file within realRoot.
+// Errors wrapping errSkipResultFile are returned for other files.
+func readResultFile(path string, mode iofs.FileMode, realRoot string) ([]byte, error) {
+	if mode&iofs.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: broken symbolic link", errSkipResultFile)
+		}
+		rel, err := filepath.Rel(realRoot, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%w: symbolic link pointing outside of the working directory", errSkipResultFile)
+		}
+		info, err := os.Lstat(target)
+		if err != nil {
+			return nil, err
+		}
+		path, mode = target, info.Mode().Type()
+	}
+	if reason := irregularFileReason(mode); reason != "" {
+		return nil, fmt.Errorf("%w: %s", errSkipResultFile, reason)
+	}
+
+	// Open without following symbolic links and without blocking
+	// in case the file was replaced after the checks above
+	file, err := openResultFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if reason := irregularFileReason(info.Mode().Type()); reason != "" {
+		return nil, fmt.Errorf("%w: %s", errSkipResultFile, reason)
+	}
+	return io.ReadAll(file)
+}
+
+func irregularFileReason(mode iofs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return ""
+	case mode&iofs.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&iofs.ModeDir != 0:
+		return "directory"
+	case mode&iofs.ModeNamedPipe != 0:
+		return "named pipe (FIFO)"
+	case mode&iofs.ModeSocket != 0:
+		return "socket"
+	case mode&iofs.ModeDevice != 0:
+		return "device"
+	default:
+		return "irregular file"
+	}
+}
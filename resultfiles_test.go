@@ -0,0 +1,95 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testCmdOnce sync.Once
+	testCmdPath string
+	testCmdErr  error
+)
+
+// testCmd builds cmd/rcom-test-cmd once and returns its path
+func testCmd(t *testing.T) string {
+	t.Helper()
+	testCmdOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "rcom-test-cmd")
+		if err != nil {
+			testCmdErr = err
+			return
+		}
+		testCmdPath = filepath.Join(dir, "rcom-test-cmd")
+		out, err := osexec.Command("go", "build", "-o", testCmdPath, "./cmd/rcom-test-cmd").CombinedOutput()
+		if err != nil {
+			testCmdErr = fmt.Errorf("%w: %s", err, out)
+		}
+	})
+	require.NoError(t, testCmdErr, "build rcom-test-cmd")
+	return testCmdPath
+}
+
+func Test_ExecuteLocally_ResultFileSymlinks(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secretFile, []byte("secret"), 0600))
+
+	command := &Command{
+		Name: testCmd(t),
+		Args: []string{
+			"-wait=0",
+			"-createFiles=real.txt",
+			"-symlinks=" +
+				"outside.txt:" + secretFile + "," +
+				"absolute.txt:/etc/passwd," +
+				"relative.txt:../../../../../../../etc/passwd," +
+				"inside.txt:real.txt," +
+				"broken.txt:missing.txt," +
+				"dir.txt:tmp",
+		},
+		ResultFilePatterns: []string{"*.txt"},
+	}
+	result, _, err := ExecuteLocally(context.Background(), command)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"real.txt": {}, "inside.txt": {}}, result.Files)
+	assert.Equal(t,
+		map[string]string{
+			"outside.txt":  "symbolic link pointing outside of the working directory",
+			"absolute.txt": "symbolic link pointing outside of the working directory",
+			"relative.txt": "symbolic link pointing outside of the working directory",
+			"broken.txt":   "broken symbolic link",
+			"dir.txt":      "directory",
+		},
+		result.SkippedFiles,
+	)
+}
+
+func Test_ExecuteLocally_ResultFileSpecialFiles(t *testing.T) {
+	command := &Command{
+		Name:               testCmd(t),
+		Args:               []string{"-wait=0", "-createFiles=real.out", "-fifos=fifo.out", "-sockets=socket.out"},
+		ResultFilePatterns: []string{"*.out"},
+	}
+	result, _, err := ExecuteLocally(context.Background(), command)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"real.out": {}}, result.Files)
+	assert.Equal(t,
+		map[string]string{
+			"fifo.out":   "named pipe (FIFO)",
+			"socket.out": "socket",
+		},
+		result.SkippedFiles,
+	)
+}
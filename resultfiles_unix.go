@@ -0,0 +1,12 @@
+//go:build !windows
+
+package rcom
+
+import (
+	"os"
+	"syscall"
+)
+
+func openResultFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+}
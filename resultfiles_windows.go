@@ -0,0 +1,7 @@
+package rcom
+
+import "os"
+
+func openResultFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
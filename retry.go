@@ -0,0 +1,112 @@
+package rcom
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"syscall"
+	"time"
+
+	"github.com/domonda/go-types/uu"
+)
+
+// RetryPolicy configures retries of remote executions
+// that failed with a retryable error, see IsRetryable.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts
+	// including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff limits the exponentially growing delay
+	MaxBackoff time.Duration
+	// Multiplier for the delay after every retry,
+	// values below 1 default to 2
+	Multiplier float64
+	// Jitter is the fraction between 0 and 1 of the delay
+	// that is randomized to spread retries of multiple clients
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries up to 3 times
+// with delays starting at 100ms.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+// backoff returns the delay before the passed retry starting at 1
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	jitter := min(max(p.Jitter, 0), 1)
+	return time.Duration(d - d*jitter*rand.Float64())
+}
+
+// IsRetryable returns if a remote execution that failed with err
+// can safely be retried because the command was not started,
+// the server was overloaded, or the connection was reset
+// before any response was received.
+// Retries after a reset rely on the server deduplicating
+// requests by their idempotency key.
+// Errors while reading a response after its headers
+// were received are not retryable.
+func IsRetryable(err error) bool {
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		return false
+	}
+	return errors.Is(err, ErrNotStarted) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retry calls execute until it returns no error,
+// an error that is not retryable, or the attempts
+// of the policy are exhausted.
+func (p *RetryPolicy) retry(ctx context.Context, execute func() (*Result, error)) (*Result, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := execute()
+		if err == nil || attempt >= p.MaxAttempts || !IsRetryable(err) {
+			return result, err
+		}
+		delay := p.backoff(attempt)
+		log.Warn("Retrying remote execution").
+			Err(err).
+			Int("attempt", attempt).
+			Stringer("delay", delay).
+			Log()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// ExecuteRemotelyWithRetry executes the command at the server
+// with the passed address like ExecuteRemotely,
+// but retries retryable errors with the retry policy.
+// All attempts send the same idempotency key so that
+// the server never executes the command twice.
+func ExecuteRemotelyWithRetry(ctx context.Context, addr string, c *Command, retry RetryPolicy) (*Result, error) {
+	key := uu.IDv7().String()
+	return retry.retry(ctx, func() (*Result, error) {
+		return executeRemotely(ctx, nil, addr, c, key, nil)
+	})
+}
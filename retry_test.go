@@ -0,0 +1,84 @@
+package rcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5}
+	for retry, maxDelay := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+	} {
+		d := p.backoff(retry)
+		assert.LessOrEqual(t, d, maxDelay)
+		assert.GreaterOrEqual(t, d, maxDelay/2)
+	}
+}
+
+func Test_IsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(fmt.Errorf("%w: dial", ErrNotStarted)))
+	assert.True(t, IsRetryable(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	assert.False(t, IsRetryable(&responseError{err: io.ErrUnexpectedEOF}), "response was received")
+	assert.False(t, IsRetryable(errors.New("command failed")))
+	assert.False(t, IsRetryable(context.Canceled))
+}
+
+func Test_ExecuteRemotelyWithRetry(t *testing.T) {
+	svc := &service{policy: NewPolicy(copyCmd())}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		svc.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	command, expectedFile := cpCommand()
+	retry := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	result, err := ExecuteRemotelyWithRetry(context.Background(), server.URL, command, retry)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, result.Files[expectedFile.Name()])
+	assert.Equal(t, int32(3), requests.Load())
+
+	requests.Store(0)
+	retry.MaxAttempts = 2
+	_, err = ExecuteRemotelyWithRetry(context.Background(), server.URL, command, retry)
+	assert.ErrorIs(t, err, ErrNotStarted, "attempts exhausted")
+}
+
+func Test_service_IdempotencyKey(t *testing.T) {
+	server := httptest.NewServer(&service{policy: NewPolicy(copyCmd())})
+	defer server.Close()
+
+	command, _ := cpCommand()
+	first, err := executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	require.NoError(t, err)
+	retried, err := executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.CallID, retried.CallID, "command executed only once")
+
+	other, err := executeRemotely(context.Background(), nil, server.URL, command, "other-key", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.CallID, other.CallID)
+
+	command.Args = []string{"input.txt", "different.txt"}
+	_, err = executeRemotely(context.Background(), nil, server.URL, command, "key", nil)
+	assert.Error(t, err, "key reused for a different request")
+}
@@ -0,0 +1,107 @@
+package rcom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ungerik/go-fs"
+)
+
+// SecretSource defines where a server reads a secret from,
+// either File or Env must be set.
+type SecretSource struct {
+	// File is the path of a file containing the secret
+	File string `json:"file,omitempty"`
+	// Env is the name of an environment variable
+	// of the server process containing the secret
+	Env string `json:"env,omitempty"`
+}
+
+func (s *SecretSource) read() ([]byte, error) {
+	switch {
+	case s == nil || (s.File == "") == (s.Env == ""):
+		return nil, errors.New("either file or env must be set")
+	case s.File != "":
+		return fs.File(s.File).ReadAll()
+	default:
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %q not set", s.Env)
+		}
+		return []byte(value), nil
+	}
+}
+
+// SecretRef references a secret held by the server
+// that is passed to the command as environment variable
+// and/or as file in the working directory of the command.
+// The secret value is masked in the output of the command
+// and in the files of Command.StdoutFile and Command.StderrFile,
+// other result files are returned unchanged
+// because masking could corrupt binary files.
+// Commands must not write secrets to result files.
+type SecretRef struct {
+	// Name of the secret in Policy.Secrets
+	Name string
+	// EnvVar is the name of the environment variable
+	// that is set to the secret value
+	EnvVar string
+	// FileName is the name of the file in the working directory
+	// that the secret is written to.
+	// The file is removed before result files are collected.
+	FileName string
+}
+
+func (r *SecretRef) validate() error {
+	if r.Name == "" {
+		return errors.New("empty secret name")
+	}
+	if r.EnvVar == "" && r.FileName == "" {
+		return fmt.Errorf("secret %q is neither passed as environment variable nor as file", r.Name)
+	}
+	if r.EnvVar != "" {
+		err := EnvVar{Name: r.EnvVar}.validate()
+		if err != nil {
+			return err
+		}
+	}
+	if r.FileName != "" {
+		err := validateFilePath(r.FileName)
+		if err != nil {
+			return fmt.Errorf("secret %q: %w", r.Name, err)
+		}
+		if strings.Contains(r.FileName, "/") {
+			return fmt.Errorf("secret %q: filename must not contain path separators", r.Name)
+		}
+	}
+	return nil
+}
+
+// redactor masks secret values in command outputs
+type redactor []string
+
+func newRedactor(secrets [][]byte) redactor {
+	var r redactor
+	for _, secret := range secrets {
+		// Secrets read from files often end with a newline
+		// that should not be masked
+		value := strings.TrimSpace(string(secret))
+		if value != "" && !slices.Contains(r, value) {
+			r = append(r, value)
+		}
+	}
+	// Replace longer values first so that a secret
+	// containing another one is completely masked
+	slices.SortFunc(r, func(a, b string) int { return len(b) - len(a) })
+	return r
+}
+
+func (r redactor) redact(s string) string {
+	for _, secret := range r {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return s
+}
@@ -2,41 +2,178 @@ package rcom
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/domonda/go-rcom/pkg/exec"
 )
 
+// ListenAndServe executes the allowed commands
+// for requests on the passed port.
 func ListenAndServe(port uint16, gracefulShutdown bool, allowedCMDs ...string) error {
-	cmds := make(map[string]bool)
-	for _, cmd := range allowedCMDs {
-		cmds[cmd] = true
+	return ListenAndServePolicy(port, gracefulShutdown, NewPolicy(allowedCMDs...))
+}
+
+// ListenAndServePolicy executes the commands allowed by the policy
+// for requests on the passed port.
+func ListenAndServePolicy(port uint16, gracefulShutdown bool, policy *Policy) error {
+	return ListenAndServeAddr(fmt.Sprintf(":%d", port), gracefulShutdown, policy)
+}
+
+// ListenAndServeAddr executes the commands allowed by the policy
+// for requests on the passed address which is either
+// a TCP address like ":3666" or "localhost:3666",
+// or a Unix domain socket address like "unix:///var/run/rcom.sock".
+// The middlewares are chained around the local execution of commands.
+func ListenAndServeAddr(addr string, gracefulShutdown bool, policy *Policy, middlewares ...Middleware) error {
+	svc, err := newPolicyService(policy, middlewares...)
+	if err != nil {
+		return err
+	}
+	listener, err := listen(addr)
+	if err != nil {
+		return err
 	}
-	svc := &service{allowedCMDs: cmds}
+
+	// Canceling baseCtx stops all running commands
+	// with the stop sequence of the policy
+	baseCtx, stopCommands := context.WithCancel(context.Background())
+	defer stopCommands()
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: svc,
+		Handler:     svc,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
-	if gracefulShutdown {
-		gracefullyShutdownServerOnSignal(server, GracefulShutdownTimeout)
+	if !gracefulShutdown {
+		return server.Serve(listener)
 	}
-	return server.ListenAndServe()
+
+	shutdownDone := gracefullyShutdownServerOnSignal(server, GracefulShutdownTimeout, svc, stopCommands)
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns immediately after
+		// the shutdown started, wait until it's complete
+		<-shutdownDone
+	}
+	return err
+}
+
+// NewHandler returns an http.Handler that executes
+// the commands allowed by the policy for requests.
+// It can be used to serve rcom with a custom http.Server
+// or with net/http/httptest in tests.
+// The middlewares are chained around the local execution of commands.
+// Batches are posted to the path "/batch" of the handler,
+// use http.StripPrefix to serve it under a path prefix.
+func NewHandler(policy *Policy, middlewares ...Middleware) (http.Handler, error) {
+	return newPolicyService(policy, middlewares...)
 }
 
 type service struct {
-	allowedCMDs map[string]bool
+	policy *Policy
+	// queue limits the number of parallel executions if not nil
+	queue chan struct{}
+	// running requests
+	running sync.WaitGroup
+	// executions by idempotency key
+	executions executions
+	// executer executes commands locally with the policy
+	// wrapped by middlewares, see service.execute
+	executer Executer
+}
+
+// newPolicyService validates the policy
+// and loads its secrets before returning a service
+func newPolicyService(policy *Policy, middlewares ...Middleware) (*service, error) {
+	if policy == nil {
+		return nil, errors.New("rcom: nil policy")
+	}
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+	err = policy.LoadSecrets()
+	if err != nil {
+		return nil, err
+	}
+	return newService(policy, middlewares...), nil
+}
+
+func newService(policy *Policy, middlewares ...Middleware) *service {
+	s := &service{policy: policy}
+	if policy.MaxConcurrent > 0 {
+		s.queue = make(chan struct{}, policy.MaxConcurrent)
+	}
+	if len(middlewares) > 0 {
+		s.executer = Chain(s.localExecuter(), middlewares...)
+	}
+	return s
+}
+
+// localExecuter returns an Executer that executes
+// commands locally with the policy of the service.
+func (s *service) localExecuter() Executer {
+	return ExecuterFunc(func(ctx context.Context, command *Command) (*Result, error) {
+		result, callID, err := ExecuteLocallyWithPolicy(ctx, command, s.policy)
+		if err != nil {
+			log.Error("error while executing command").
+				Err(err).
+				UUID("callID", callID).
+				Str("correlationID", correlationIDFromContext(ctx)).
+				Log()
+		}
+		return result, err
+	})
+}
+
+// execute executes the command with the middlewares
+// of the service around the local execution.
+func (s *service) execute(ctx context.Context, command *Command) (*Result, error) {
+	executer := s.executer
+	if executer == nil {
+		executer = s.localExecuter()
+	}
+	result, err := executer.Execute(ctx, command)
+	if result == nil && err == nil {
+		err = errors.New("rcom: executer returned neither result nor error")
+	}
+	return result, err
 }
 
 func (s *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.running.Add(1)
+	defer s.running.Done()
 	defer r.Body.Close()
 
+	if r.URL.Path == batchPath {
+		s.serveBatch(w, r)
+		return
+	}
+
+	var phases Phases
+	phaseStart := time.Now()
+
+	// The fingerprint identifies the request
+	// for deduplication by idempotency key
+	hash := sha256.New()
+	body := io.TeeReader(r.Body, hash)
 	var command *Command
-	err := gob.NewDecoder(r.Body).Decode(&command)
+	err := gob.NewDecoder(body).Decode(&command)
+	if err == nil {
+		_, err = io.Copy(io.Discard, body)
+	}
+	phases.Decode = time.Since(phaseStart)
 	if err != nil {
 		log.Error("can't decode command request").
 			Err(err).
@@ -45,41 +182,170 @@ func (s *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !s.allowedCMDs[command.Name] {
-		http.Error(w, fmt.Sprintf("command %q not allowed", command.Name), http.StatusBadRequest)
+	err = s.checkPolicy(command)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Infof("Executing command: %s", command).Log()
-	result, callID, err := ExecuteLocally(r.Context(), command)
-	if err != nil {
-		log.Error("error while executing command").
-			Err(err).
-			UUID("callID", callID).
+	// Logged with the execution to correlate it with the logs of the client
+	correlationID := r.Header.Get(correlationIDHeader)
+	ctx := contextWithCorrelationID(r.Context(), correlationID)
+	key := r.Header.Get(idempotencyKeyHeader)
+	var exe *execution
+	for key != "" {
+		var isNew bool
+		exe, isNew, err = s.executions.begin(key, [sha256.Size]byte(hash.Sum(nil)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if isNew {
+			break
+		}
+		// Retried request, never execute the command twice
+		log.Info("Waiting for execution of request with same idempotency key").
+			Str("idempotencyKey", key).
 			Log()
+		select {
+		case <-exe.done:
+		case <-ctx.Done():
+			http.Error(w, ctx.Err().Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if exe.result != nil || exe.err != nil {
+			s.writeResponse(w, r, command, exe.result, exe.err, phases)
+			return
+		}
+		// The other request was canceled before
+		// its execution completed, execute it for this one
+	}
+
+	phaseStart = time.Now()
+	release, err := s.acquire(ctx)
+	if err != nil {
+		if exe != nil {
+			s.executions.abort(exe)
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+	phases.Queue = time.Since(phaseStart)
+
+	log.Infof("Executing command: %s", command).
+		Str("correlationID", correlationID).
+		Log()
+	result, err := s.execute(ctx, command)
+	var stopped *exec.StoppedError
+	switch {
+	case exe == nil:
+	case err != nil && ctx.Err() != nil && (errors.As(err, &stopped) || errors.Is(err, context.Canceled)):
+		// The execution was stopped because the request was canceled,
+		// most likely because its connection failed and the client
+		// retries it, so don't return the cancel error to the retry.
+		// Completed executions are kept even if the request
+		// was canceled afterwards to never execute them twice.
+		s.executions.abort(exe)
+	default:
+		s.executions.finish(exe, result, err)
+	}
+	s.writeResponse(w, r, command, result, err, phases)
+}
+
+// checkPolicy returns an error if the policy does not allow
+// all commands of the command or their arguments.
+func (s *service) checkPolicy(command *Command) error {
+	for _, name := range command.names() {
+		if !s.policy.Allows(name) {
+			return fmt.Errorf("command %q not allowed", name)
+		}
+		if command.PTY != nil && !s.policy.AllowsPTY(name) {
+			return fmt.Errorf("PTY not allowed for command %q", name)
+		}
+	}
+	return s.policy.checkSpec(command)
+}
+
+// acquire waits until the number of parallel executions
+// is below the limit of the policy or the context is canceled.
+// The returned function has to be called after the execution.
+func (s *service) acquire(ctx context.Context) (release func(), err error) {
+	if s.queue == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.queue <- struct{}{}:
+		return func() { <-s.queue }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// writeResponse writes the result or the error of an execution.
+// The result is not modified because it could be shared
+// by requests with the same idempotency key.
+// Result files are streamed as separate parts
+// if the request accepts streamed files.
+func (s *service) writeResponse(w http.ResponseWriter, r *http.Request, command *Command, result *Result, err error, phases Phases) {
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// Can't fail for the simple struct
+			j, _ := json.Marshal(exitErr)
+			w.Header().Set(exitErrorHeader, string(j))
+		}
+		var pipelineErr *PipelineError
+		if errors.As(err, &pipelineErr) {
+			w.Header().Set(pipelineErrorHeader, "gob")
+			w.Header().Set("Content-Type", "application/x-gob")
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = gob.NewEncoder(w).Encode(pipelineErr)
+			return
+		}
 		http.Error(w, fmt.Sprintf("%s\n\n%s", command, err), http.StatusInternalServerError)
 		return
 	}
 
-	err = gob.NewEncoder(w).Encode(result)
+	response := *result
+	response.Report.Phases.Decode = phases.Decode
+	response.Report.Phases.Queue = phases.Queue
+
+	// The encode duration is sent as trailer after the result
+	w.Header().Set("Trailer", encodeDurationTrailer)
+	phaseStart := time.Now()
+	if acceptsStreamedFiles(r) {
+		err = encodeStreamedFiles(w, &response)
+	} else {
+		err = gob.NewEncoder(w).Encode(&response)
+	}
 	if err != nil {
 		log.Error("can't encoding command response").
 			Err(err).
-			UUID("callID", callID).
+			UUID("callID", result.CallID).
 			Log()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set(encodeDurationTrailer, time.Since(phaseStart).String())
 }
 
-func gracefullyShutdownServerOnSignal(server *http.Server, timeout time.Duration, signals ...os.Signal) {
+// gracefullyShutdownServerOnSignal shuts down the server
+// when one of the signals is received.
+// Commands that are still running after the timeout
+// are stopped by calling stopCommands.
+// The returned channel is closed when the shutdown is complete.
+func gracefullyShutdownServerOnSignal(server *http.Server, timeout time.Duration, svc *service, stopCommands context.CancelFunc, signals ...os.Signal) <-chan struct{} {
 	if len(signals) == 0 {
 		signals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}
 	}
 
+	done := make(chan struct{})
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, signals...)
 	go func() {
+		defer close(done)
+
 		sig := <-shutdown
 		log.Debugf("Received signal %s", sig).Log()
 
@@ -94,5 +360,11 @@ func gracefullyShutdownServerOnSignal(server *http.Server, timeout time.Duration
 		if err != nil {
 			log.Error("Server shutdown error").Err(err).Log()
 		}
+
+		// Stop commands that are still running
+		// and wait for their stop sequences
+		stopCommands()
+		svc.running.Wait()
 	}()
+	return done
 }
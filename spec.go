@@ -0,0 +1,403 @@
+package rcom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ungerik/go-fs"
+)
+
+// ArgType is the type of the value of an argument
+type ArgType string
+
+const (
+	// ArgString is any non empty string
+	ArgString ArgType = "string"
+	// ArgInt is an integer
+	ArgInt ArgType = "int"
+	// ArgFloat is a floating point number
+	ArgFloat ArgType = "float"
+	// ArgBool is a flag without value
+	// that is passed if true
+	ArgBool ArgType = "bool"
+)
+
+// CommandSpec describes the arguments, input files and output files
+// of a command. It is usually loaded from a JSON file
+// and used by cmd/rcom-gen to generate a typed Go function
+// for the command and by a server to validate the arguments
+// of requests, see CommandPolicy.Spec.
+type CommandSpec struct {
+	// Command is the name of the executed command like "pdftoppm"
+	Command string `json:"command"`
+	// Func is the name of the generated function.
+	// It defaults to the command name in camel case like "Pdftoppm".
+	Func string `json:"func,omitempty"`
+	// Doc is the documentation of the generated function
+	Doc string `json:"doc,omitempty"`
+	// Args in the order they are passed to the command
+	Args []ArgSpec `json:"args,omitempty"`
+	// InputFiles are the only files that may be
+	// written to the working directory of the command
+	InputFiles []FileSpec `json:"inputFiles,omitempty"`
+	// OutputFiles are returned as result files
+	OutputFiles []FileSpec `json:"outputFiles,omitempty"`
+}
+
+// ArgSpec describes an argument of a command.
+// An argument without Name is a constant Value,
+// optionally preceded by its Flag.
+// An argument with Name is a parameter of the generated function.
+// Parameters with a Flag are passed as the flag followed by the value
+// or only as the flag for the ArgBool type,
+// and are omitted if they are not required and have the zero value.
+// Parameters without a Flag are positional and always required.
+type ArgSpec struct {
+	// Name of the parameter as exported Go identifier
+	Name string `json:"name,omitempty"`
+	// Doc is the documentation of the parameter
+	Doc string `json:"doc,omitempty"`
+	// Flag like "-r" or "--resolution"
+	Flag string `json:"flag,omitempty"`
+	// Type of the value, defaults to ArgString
+	Type ArgType `json:"type,omitempty"`
+	// Value of a constant argument
+	Value string `json:"value,omitempty"`
+	// Required parameters are always passed,
+	// ArgBool parameters can't be required
+	Required bool `json:"required,omitempty"`
+	// Enum lists the allowed values if not empty
+	Enum []string `json:"enum,omitempty"`
+	// Min and Max limit the values of ArgInt and ArgFloat parameters
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// FileSpec describes an input or output file of a command.
+type FileSpec struct {
+	// Name of the parameter or output as exported Go identifier
+	Name string `json:"name"`
+	// Doc is the documentation of the file
+	Doc string `json:"doc,omitempty"`
+	// File is the slash separated path of the file
+	// in the working directory like "input.pdf".
+	// For output files with Multiple set it is
+	// a result file pattern like "page-*.png".
+	File string `json:"file"`
+	// Required input files have to be passed
+	// and required output files have to be created
+	Required bool `json:"required,omitempty"`
+	// Multiple output files are returned
+	// as map from file name to data
+	Multiple bool `json:"multiple,omitempty"`
+}
+
+// ParseCommandSpec parses and validates a CommandSpec from JSON.
+func ParseCommandSpec(data []byte) (*CommandSpec, error) {
+	s := new(CommandSpec)
+	err := json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse command spec: %w", err)
+	}
+	err = s.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MustParseCommandSpec parses a CommandSpec like ParseCommandSpec
+// and panics on error. It is used by generated code.
+func MustParseCommandSpec(data []byte) *CommandSpec {
+	s, err := ParseCommandSpec(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// LoadCommandSpecFile reads and validates a CommandSpec from a JSON file.
+func LoadCommandSpecFile(file fs.File) (*CommandSpec, error) {
+	data, err := file.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseCommandSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command spec file %s: %w", file.Name(), err)
+	}
+	return s, nil
+}
+
+// FuncName returns Func or the command name in camel case.
+func (s *CommandSpec) FuncName() string {
+	if s.Func != "" {
+		return s.Func
+	}
+	var b strings.Builder
+	upper := true
+	for _, r := range s.Command {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Validate returns an error if the spec is incomplete,
+// has invalid names, types or file paths.
+func (s *CommandSpec) Validate() error {
+	if s.Command == "" {
+		return errors.New("command spec without command name")
+	}
+	if name := s.FuncName(); !isExportedIdentifier(name) {
+		return fmt.Errorf("command spec %s: function name %q is not an exported Go identifier", s.Command, name)
+	}
+	params := make(map[string]bool)
+	addParam := func(name string) error {
+		if !isExportedIdentifier(name) {
+			return fmt.Errorf("command spec %s: name %q is not an exported Go identifier", s.Command, name)
+		}
+		if params[name] {
+			return fmt.Errorf("command spec %s: duplicate name %q", s.Command, name)
+		}
+		params[name] = true
+		return nil
+	}
+	for i := range s.Args {
+		arg := &s.Args[i]
+		if arg.Type == "" {
+			arg.Type = ArgString
+		}
+		err := arg.validate()
+		if err != nil {
+			return fmt.Errorf("command spec %s: argument %d: %w", s.Command, i+1, err)
+		}
+		if arg.Name != "" {
+			err = addParam(arg.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	files := make(map[string]bool)
+	for _, file := range s.InputFiles {
+		err := addParam(file.Name)
+		if err != nil {
+			return err
+		}
+		err = validateFilePath(file.File)
+		if err != nil {
+			return fmt.Errorf("command spec %s: input file %s: %w", s.Command, file.Name, err)
+		}
+		if files[file.File] {
+			return fmt.Errorf("command spec %s: duplicate input file %q", s.Command, file.File)
+		}
+		files[file.File] = true
+		if file.Multiple {
+			return fmt.Errorf("command spec %s: input file %s can't be multiple", s.Command, file.Name)
+		}
+	}
+	outputs := make(map[string]bool)
+	for _, file := range s.OutputFiles {
+		if !isExportedIdentifier(file.Name) || outputs[file.Name] {
+			return fmt.Errorf("command spec %s: invalid or duplicate output file name %q", s.Command, file.Name)
+		}
+		outputs[file.Name] = true
+		var err error
+		if file.Multiple {
+			err = validateFilePattern(file.File)
+		} else {
+			err = validateFilePath(file.File)
+			if err == nil && strings.ContainsAny(file.File, `*?[`) {
+				err = fmt.Errorf("pattern %q needs multiple", file.File)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("command spec %s: output file %s: %w", s.Command, file.Name, err)
+		}
+	}
+	return nil
+}
+
+func (a *ArgSpec) validate() error {
+	if a.Name == "" {
+		if a.Value == "" {
+			return errors.New("constant without value")
+		}
+		return nil
+	}
+	if a.Value != "" {
+		return fmt.Errorf("parameter %s can't have a constant value", a.Name)
+	}
+	switch a.Type {
+	case ArgString, ArgInt, ArgFloat:
+	case ArgBool:
+		if a.Flag == "" {
+			return fmt.Errorf("bool parameter %s needs a flag", a.Name)
+		}
+		if len(a.Enum) > 0 || a.Min != nil || a.Max != nil {
+			return fmt.Errorf("bool parameter %s can't have enum values or limits", a.Name)
+		}
+		// A required flag could only ever be true
+		if a.Required {
+			return fmt.Errorf("bool parameter %s can't be required", a.Name)
+		}
+	default:
+		return fmt.Errorf("parameter %s has invalid type %q", a.Name, a.Type)
+	}
+	if (a.Min != nil || a.Max != nil) && a.Type == ArgString {
+		return fmt.Errorf("string parameter %s can't have limits", a.Name)
+	}
+	for _, value := range a.Enum {
+		err := a.validateType(value)
+		if err != nil {
+			return fmt.Errorf("parameter %s has invalid enum value: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// IsPositional returns if the argument is a parameter without flag
+func (a *ArgSpec) IsPositional() bool {
+	return a.Name != "" && a.Flag == ""
+}
+
+// validateType checks if the value can be parsed as the type of the argument
+func (a *ArgSpec) validateType(value string) error {
+	switch a.Type {
+	case ArgInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case ArgFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+	}
+	return nil
+}
+
+// validateValue checks a value passed for the parameter
+func (a *ArgSpec) validateValue(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value for %s", a.Name)
+	}
+	// Values starting with a dash could be interpreted as flags
+	if a.IsPositional() && a.Type == ArgString && strings.HasPrefix(value, "-") {
+		return fmt.Errorf("value %q for %s must not start with a dash", value, a.Name)
+	}
+	err := a.validateType(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", a.Name, err)
+	}
+	if len(a.Enum) > 0 && !slices.Contains(a.Enum, value) {
+		return fmt.Errorf("value %q for %s is not one of %s", value, a.Name, strings.Join(a.Enum, ", "))
+	}
+	if a.Min != nil || a.Max != nil {
+		// Parsing can't fail after validateType
+		number, _ := strconv.ParseFloat(value, 64)
+		if a.Min != nil && number < *a.Min {
+			return fmt.Errorf("value %s for %s is less than %v", value, a.Name, *a.Min)
+		}
+		if a.Max != nil && number > *a.Max {
+			return fmt.Errorf("value %s for %s is greater than %v", value, a.Name, *a.Max)
+		}
+	}
+	return nil
+}
+
+// ValidateArgs returns an error if the arguments
+// don't match the argument specs in their order.
+func (s *CommandSpec) ValidateArgs(args []string) error {
+	i := 0
+	for _, arg := range s.Args {
+		switch {
+		case arg.Name == "":
+			constant := []string{arg.Value}
+			if arg.Flag != "" {
+				constant = []string{arg.Flag, arg.Value}
+			}
+			for _, value := range constant {
+				if i >= len(args) || args[i] != value {
+					return fmt.Errorf("%s: expected argument %q at position %d", s.Command, value, i+1)
+				}
+				i++
+			}
+
+		case arg.Flag != "":
+			if i >= len(args) || args[i] != arg.Flag {
+				if arg.Required {
+					return fmt.Errorf("%s: missing required flag %s at position %d", s.Command, arg.Flag, i+1)
+				}
+				continue
+			}
+			i++
+			if arg.Type == ArgBool {
+				continue
+			}
+			if i >= len(args) {
+				return fmt.Errorf("%s: missing value for flag %s", s.Command, arg.Flag)
+			}
+			err := arg.validateValue(args[i])
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.Command, err)
+			}
+			i++
+
+		default:
+			if i >= len(args) {
+				return fmt.Errorf("%s: missing argument %s", s.Command, arg.Name)
+			}
+			err := arg.validateValue(args[i])
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.Command, err)
+			}
+			i++
+		}
+	}
+	if i < len(args) {
+		return fmt.Errorf("%s: unexpected argument %q at position %d", s.Command, args[i], i+1)
+	}
+	return nil
+}
+
+// ValidateCommand returns an error if the command
+// does not match the spec because of its name,
+// its arguments, unknown or missing input files.
+func (s *CommandSpec) ValidateCommand(c *Command) error {
+	if c.Name != s.Command {
+		return fmt.Errorf("command %q does not match spec of %q", c.Name, s.Command)
+	}
+	err := s.ValidateArgs(c.Args)
+	if err != nil {
+		return err
+	}
+	for name := range c.Files {
+		if !slices.ContainsFunc(s.InputFiles, func(file FileSpec) bool { return file.File == name }) {
+			return fmt.Errorf("%s: unexpected input file %q", s.Command, name)
+		}
+	}
+	for _, file := range s.InputFiles {
+		if _, ok := c.Files[file.File]; file.Required && !ok {
+			return fmt.Errorf("%s: missing required input file %q", s.Command, file.File)
+		}
+	}
+	return nil
+}
+
+func isExportedIdentifier(name string) bool {
+	return token.IsIdentifier(name) && token.IsExported(name)
+}
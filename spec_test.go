@@ -0,0 +1,99 @@
+package rcom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpecJSON = `{
+	"command": "pdftoppm",
+	"args": [
+		{"value": "-png"},
+		{"name": "Resolution", "flag": "-r", "type": "int", "min": 1, "max": 1200},
+		{"name": "Gray", "flag": "-gray", "type": "bool"},
+		{"name": "Mode", "flag": "-aa", "enum": ["yes", "no"]},
+		{"value": "input.pdf"},
+		{"name": "Prefix"}
+	],
+	"inputFiles": [{"name": "PDF", "file": "input.pdf", "required": true}],
+	"outputFiles": [{"name": "Pages", "file": "*.png", "multiple": true}]
+}`
+
+func Test_CommandSpec_ValidateArgs(t *testing.T) {
+	spec, err := ParseCommandSpec([]byte(testSpecJSON))
+	require.NoError(t, err)
+	assert.Equal(t, "Pdftoppm", spec.FuncName())
+
+	valid := [][]string{
+		{"-png", "input.pdf", "page"},
+		{"-png", "-r", "150", "-gray", "input.pdf", "page"},
+		{"-png", "-aa", "no", "input.pdf", "page"},
+	}
+	for _, args := range valid {
+		assert.NoError(t, spec.ValidateArgs(args), "%v", args)
+	}
+	invalid := [][]string{
+		{},
+		{"-png", "input.pdf"},
+		{"-png", "input.pdf", "-page"},
+		{"-png", "-r", "0", "input.pdf", "page"},
+		{"-png", "-r", "abc", "input.pdf", "page"},
+		{"-png", "-aa", "maybe", "input.pdf", "page"},
+		{"-png", "-gray", "-r", "150", "input.pdf", "page"},
+		{"-png", "other.pdf", "page"},
+		{"-png", "input.pdf", "page", "extra"},
+	}
+	for _, args := range invalid {
+		assert.Error(t, spec.ValidateArgs(args), "%v", args)
+	}
+
+	command := &Command{Name: "pdftoppm", Args: valid[0], Files: map[string][]byte{"input.pdf": nil}}
+	assert.NoError(t, spec.ValidateCommand(command))
+	command.Files = map[string][]byte{"input.pdf": nil, "other.txt": nil}
+	assert.Error(t, spec.ValidateCommand(command), "unexpected input file")
+	command.Files = nil
+	assert.Error(t, spec.ValidateCommand(command), "missing input file")
+}
+
+func Test_CommandSpec_Validate(t *testing.T) {
+	invalid := []string{
+		`{}`,
+		`{"command": "x", "args": [{"name": "lower"}]}`,
+		`{"command": "x", "args": [{"name": "A"}, {"name": "A"}]}`,
+		`{"command": "x", "args": [{"name": "A", "type": "bool"}]}`,
+		`{"command": "x", "args": [{"name": "A", "flag": "-a", "type": "bool", "required": true}]}`,
+		`{"command": "x", "args": [{"name": "A", "type": "int", "enum": ["a"]}]}`,
+		`{"command": "x", "args": [{"name": "A", "value": "v"}]}`,
+		`{"command": "x", "inputFiles": [{"name": "A", "file": "../a"}]}`,
+		`{"command": "x", "outputFiles": [{"name": "A", "file": "*.txt"}]}`,
+	}
+	for _, spec := range invalid {
+		_, err := ParseCommandSpec([]byte(spec))
+		assert.Error(t, err, spec)
+	}
+}
+
+func Test_Policy_Spec(t *testing.T) {
+	spec := &CommandSpec{
+		Command:    copyCmd(),
+		Args:       []ArgSpec{{Value: "input.txt"}, {Name: "Output"}},
+		InputFiles: []FileSpec{{Name: "Input", File: "input.txt"}},
+	}
+	policy := &Policy{Commands: map[string]*CommandPolicy{copyCmd(): {Spec: spec}}}
+	require.NoError(t, policy.Validate())
+
+	command, expectedFile := cpCommand()
+	result, _, err := ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFile.FileData, result.Files[expectedFile.Name()])
+
+	command.Args = []string{"input.txt", "-output.txt"}
+	_, _, err = ExecuteLocallyWithPolicy(context.Background(), command, policy)
+	assert.Error(t, err)
+
+	policy.Commands[copyCmd()].Spec = &CommandSpec{Command: "other"}
+	assert.Error(t, policy.Validate(), "spec of other command")
+}
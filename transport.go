@@ -0,0 +1,119 @@
+package rcom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// unixScheme is the prefix of Unix domain socket addresses
+// like "unix:///var/run/rcom.sock"
+const unixScheme = "unix://"
+
+// unixSocketPath returns the socket path of an address
+// with the "unix://" scheme.
+func unixSocketPath(addr string) (path string, ok bool) {
+	path, ok = strings.CutPrefix(addr, unixScheme)
+	return path, ok && path != ""
+}
+
+// unixURL is the URL of requests to Unix domain sockets
+const unixURL = "http://unix"
+
+// unixTransport is the transport of HTTP clients
+// for the Unix domain socket at path
+type unixTransport struct {
+	*http.Transport
+	path string
+}
+
+// defaultUnixClients caches the HTTP clients derived
+// from http.DefaultClient for Unix domain sockets
+// by socket path to reuse their connections
+var defaultUnixClients sync.Map // map[string]*http.Client
+
+// httpClientFor returns the URL to post requests to and
+// the HTTP client to use for the address which is either
+// a URL with http or https scheme, "host:port",
+// or a Unix domain socket address with the "unix://" scheme.
+// A nil client defaults to http.DefaultClient.
+// The HTTP client for a Unix domain socket is derived from client
+// unless client already is one for the socket.
+// Derived clients are only cached for http.DefaultClient,
+// others have to be kept by the caller to reuse connections.
+func httpClientFor(client *http.Client, addr string) (url string, _ *http.Client, err error) {
+	path, ok := unixSocketPath(addr)
+	if !ok {
+		if client == nil {
+			client = http.DefaultClient
+		}
+		return endpointURL(addr), client, nil
+	}
+
+	if client == nil {
+		if c, ok := defaultUnixClients.Load(path); ok {
+			return unixURL, c.(*http.Client), nil
+		}
+		c, err := unixClient(http.DefaultClient, addr, path)
+		if err != nil {
+			return "", nil, err
+		}
+		cached, _ := defaultUnixClients.LoadOrStore(path, c)
+		return unixURL, cached.(*http.Client), nil
+	}
+	if t, ok := client.Transport.(*unixTransport); ok && t.path == path {
+		return unixURL, client, nil
+	}
+	client, err = unixClient(client, addr, path)
+	if err != nil {
+		return "", nil, err
+	}
+	return unixURL, client, nil
+}
+
+// unixClient returns a copy of client with a transport
+// that connects to the Unix domain socket at path.
+func unixClient(client *http.Client, addr, path string) (*http.Client, error) {
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("Unix domain socket address %q needs an *http.Transport instead of %T", addr, t)
+	}
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	c := *client
+	c.Transport = &unixTransport{Transport: transport, path: path}
+	return &c, nil
+}
+
+// listen listens on a TCP address like ":3666"
+// or a Unix domain socket address like "unix:///var/run/rcom.sock".
+// A stale socket file is removed before listening on it.
+func listen(addr string) (net.Listener, error) {
+	path, ok := unixSocketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode().Type() == os.ModeSocket {
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,80 @@
+package rcom
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ungerik/go-fs"
+)
+
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_Client_UnixSocket(t *testing.T) {
+	// Short path because of the socket path length limit
+	dir, err := os.MkdirTemp("", "rcom")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := unixScheme + filepath.Join(dir, "rcom.sock")
+
+	listener, err := listen(addr)
+	require.NoError(t, err)
+	server := &http.Server{Handler: &service{policy: NewPolicy(copyCmd())}}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := NewClient(ClientWithCmds(copyCmd()), ClientWithBaseURL(addr))
+	input := fs.NewMemFile("input.txt", []byte("rcom test file"))
+	result, err := client.ExecuteArgs(context.Background(), []string{"input.txt", "output.txt"}, []fs.FileReader{input}, "output.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("rcom test file"), result.Files["output.txt"])
+
+	_, err = ExecuteRemotely(context.Background(), addr, &Command{Name: copyCmd(), Args: []string{"input.txt", "output.txt"}, Files: map[string][]byte{"input.txt": nil}})
+	assert.NoError(t, err)
+
+	// The client derived from a custom HTTP client
+	// is kept by the Client instead of a global cache
+	client = NewClient(ClientWithCmds(copyCmd()), ClientWithBaseURL(addr), ClientWithHTTPClient(new(http.Client)))
+	for range 2 {
+		_, err = client.ExecuteArgs(context.Background(), []string{"input.txt", "output.txt"}, []fs.FileReader{input}, "output.txt")
+		require.NoError(t, err)
+	}
+	derived := client.getEndpoints().list[0].client
+	require.IsType(t, new(unixTransport), derived.Transport)
+	_, reused, err := httpClientFor(derived, addr)
+	require.NoError(t, err)
+	assert.Same(t, derived, reused)
+}
+
+func Test_Client_BaseURLAndTransport(t *testing.T) {
+	server := httptest.NewServer(http.StripPrefix("/rcom", &service{policy: NewPolicy(copyCmd())}))
+	defer server.Close()
+
+	transport := new(countingTransport)
+	client := NewClient(
+		ClientWithCmds(copyCmd()),
+		ClientWithBaseURL(server.URL+"/rcom"),
+		ClientWithTransport(transport),
+	)
+	input := fs.NewMemFile("input.txt", []byte("rcom test file"))
+	result, err := client.ExecuteArgs(context.Background(), []string{"input.txt", "output.txt"}, []fs.FileReader{input}, "output.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("rcom test file"), result.Files["output.txt"])
+	assert.Equal(t, int32(1), transport.requests.Load())
+
+	_, _, err = httpClientFor(&http.Client{Transport: transport}, "unix:///tmp/rcom.sock")
+	assert.Error(t, err, "Unix domain sockets need an *http.Transport")
+}